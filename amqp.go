@@ -5,7 +5,11 @@
 package gocelery
 
 import (
+	"crypto/tls"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -22,3 +26,252 @@ func deliveryAck(delivery amqp.Delivery) {
 		log.Printf("amqp_backend: failed to acknowledge result message %+v: %+v", delivery.MessageId, err)
 	}
 }
+
+// AMQPOption configures AMQP connection
+type AMQPOption func(*amqp.Config)
+
+// WithAMQPTLSConfig sets TLS configuration used for amqps connections
+// such as client certificates, CA pool and server name.
+func WithAMQPTLSConfig(config *tls.Config) AMQPOption {
+	return func(c *amqp.Config) {
+		c.TLSClientConfig = config
+	}
+}
+
+// WithAMQPExternalAuth authenticates with SASL EXTERNAL mechanism.
+// Identity is taken by AMQP server from TLS client certificate.
+func WithAMQPExternalAuth() AMQPOption {
+	return func(c *amqp.Config) {
+		c.SASL = []amqp.Authentication{&amqpExternalAuth{}}
+	}
+}
+
+// WithAMQPVirtualHost overrides virtual host given in url
+func WithAMQPVirtualHost(vhost string) AMQPOption {
+	return func(c *amqp.Config) {
+		c.Vhost = vhost
+	}
+}
+
+// WithAMQPConnectTimeout sets timeout for establishing connection
+func WithAMQPConnectTimeout(timeout time.Duration) AMQPOption {
+	return func(c *amqp.Config) {
+		c.Dial = amqp.DefaultDial(timeout)
+	}
+}
+
+// WithAMQPHeartbeat sets heartbeat interval of connection
+func WithAMQPHeartbeat(heartbeat time.Duration) AMQPOption {
+	return func(c *amqp.Config) {
+		c.Heartbeat = heartbeat
+	}
+}
+
+// amqpExternalAuth is SASL EXTERNAL authentication
+type amqpExternalAuth struct{}
+
+func (auth *amqpExternalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (auth *amqpExternalAuth) Response() string {
+	return ""
+}
+
+// NewAMQPConnectionWithOptions creates new AMQP connection and channel configured with given options.
+// Unlike NewAMQPConnection, it returns error instead of panicking.
+func NewAMQPConnectionWithOptions(host string, options ...AMQPOption) (*amqp.Connection, *amqp.Channel, error) {
+	config := amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+	}
+	for _, option := range options {
+		option(&config)
+	}
+	connection, err := amqp.DialConfig(host, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	return connection, channel, nil
+}
+
+// amqpConfirmer publishes messages in publisher confirm mode
+// and waits for broker acknowledgement of each message.
+// Messages are published as mandatory so that unroutable messages
+// are reported back as errors instead of being silently dropped.
+// Confirms and returns are drained continuously, so that late confirms
+// of timed out publishes never block the connection.
+// Delivery tags are counted by confirmer, so it publishes on dedicated
+// channel which is never shared with other publishers.
+type amqpConfirmer struct {
+	mu          sync.Mutex
+	channel     *amqp.Channel
+	timeout     time.Duration
+	deliveryTag uint64
+
+	pendingLock sync.Mutex
+	pending     map[uint64]*amqpPendingPublish
+	closed      bool
+}
+
+// amqpPendingPublish is published message waiting for publisher confirm
+type amqpPendingPublish struct {
+	messageID string
+	done      chan error
+}
+
+// newAMQPConfirmer opens dedicated channel of connection, puts it into
+// confirm mode and starts listening for publisher confirms and returned messages
+func newAMQPConfirmer(conn *amqp.Connection, timeout time.Duration) (*amqpConfirmer, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, err
+	}
+	c := &amqpConfirmer{
+		channel: channel,
+		timeout: timeout,
+		pending: map[uint64]*amqpPendingPublish{},
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 16))
+	returns := channel.NotifyReturn(make(chan amqp.Return, 16))
+	go c.listen(confirms, returns)
+	return c, nil
+}
+
+// listen resolves pending publishes until channel is closed.
+// Confirms of publishes which are not pending anymore are discarded.
+func (c *amqpConfirmer) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	returned := map[string]amqp.Return{}
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				c.close()
+				return
+			}
+			returned[ret.MessageId] = ret
+		case confirm, ok := <-confirms:
+			if !ok {
+				c.close()
+				return
+			}
+			// broker sends basic.return before basic.ack for unroutable messages
+			for drained := false; !drained; {
+				select {
+				case ret, ok := <-returns:
+					if ok {
+						returned[ret.MessageId] = ret
+					} else {
+						drained = true
+					}
+				default:
+					drained = true
+				}
+			}
+			c.resolve(confirm, returned)
+		}
+	}
+}
+
+// resolve completes pending publish of given confirm.
+// Returns of messages which are not pending anymore are discarded.
+func (c *amqpConfirmer) resolve(confirm amqp.Confirmation, returned map[string]amqp.Return) {
+	c.pendingLock.Lock()
+	pending, ok := c.pending[confirm.DeliveryTag]
+	delete(c.pending, confirm.DeliveryTag)
+	for messageID := range returned {
+		if !c.isPending(messageID) && (!ok || messageID != pending.messageID) {
+			delete(returned, messageID)
+		}
+	}
+	c.pendingLock.Unlock()
+	if !ok {
+		return
+	}
+	ret, isReturned := returned[pending.messageID]
+	delete(returned, pending.messageID)
+	switch {
+	case !confirm.Ack:
+		pending.done <- fmt.Errorf("message %s was not acknowledged by amqp broker", pending.messageID)
+	case isReturned:
+		pending.done <- fmt.Errorf("message %s returned by amqp broker: %d %s", pending.messageID, ret.ReplyCode, ret.ReplyText)
+	default:
+		pending.done <- nil
+	}
+}
+
+// isPending reports whether message of given id waits for confirm, pendingLock must be held
+func (c *amqpConfirmer) isPending(messageID string) bool {
+	for _, pending := range c.pending {
+		if pending.messageID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// close fails all pending publishes after channel is closed
+func (c *amqpConfirmer) close() {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	c.closed = true
+	for deliveryTag, pending := range c.pending {
+		pending.done <- fmt.Errorf("amqp channel closed while waiting for publisher confirm")
+		delete(c.pending, deliveryTag)
+	}
+}
+
+// publish sends message and blocks until broker confirms it,
+// the message is returned as unroutable or timeout is reached
+func (c *amqpConfirmer) publish(exchange, key string, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// message id is used to match returned messages with this publish
+	if msg.MessageId == "" {
+		msg.MessageId = fmt.Sprintf("gocelery-%d", c.deliveryTag+1)
+	}
+	deliveryTag := c.deliveryTag + 1
+	pending := &amqpPendingPublish{messageID: msg.MessageId, done: make(chan error, 1)}
+	c.pendingLock.Lock()
+	if c.closed {
+		c.pendingLock.Unlock()
+		return fmt.Errorf("amqp channel closed while waiting for publisher confirm")
+	}
+	c.pending[deliveryTag] = pending
+	c.pendingLock.Unlock()
+	if err := c.channel.Publish(exchange, key, true, false, msg); err != nil {
+		c.pendingLock.Lock()
+		delete(c.pending, deliveryTag)
+		c.pendingLock.Unlock()
+		return err
+	}
+	c.deliveryTag = deliveryTag
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-pending.done:
+		return err
+	case <-timer.C:
+		c.pendingLock.Lock()
+		delete(c.pending, deliveryTag)
+		c.pendingLock.Unlock()
+		// confirm may have arrived just before timeout
+		select {
+		case err := <-pending.done:
+			return err
+		default:
+		}
+		return fmt.Errorf("%v timeout waiting for publisher confirm of message %s", c.timeout, msg.MessageId)
+	}
+}
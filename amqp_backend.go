@@ -6,7 +6,9 @@ package gocelery
 
 import (
 	"encoding/json"
+	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
@@ -17,6 +19,12 @@ type AMQPCeleryBackend struct {
 	*amqp.Channel
 	Connection *amqp.Connection
 	Host       string
+	confirmer  *amqpConfirmer
+	options    []AMQPOption
+
+	// states of unfinished tasks already taken from their result queues
+	statesLock sync.Mutex
+	states     map[string]*ResultMessage
 }
 
 // NewAMQPCeleryBackend creates new AMQPCeleryBackend
@@ -26,6 +34,19 @@ func NewAMQPCeleryBackend(host string) *AMQPCeleryBackend {
 	return backend
 }
 
+// NewAMQPCeleryBackendWithOptions creates new AMQPCeleryBackend connected with given options
+// such as TLS configuration and SASL EXTERNAL authentication
+func NewAMQPCeleryBackendWithOptions(host string, options ...AMQPOption) (*AMQPCeleryBackend, error) {
+	conn, channel, err := NewAMQPConnectionWithOptions(host, options...)
+	if err != nil {
+		return nil, err
+	}
+	backend := NewAMQPCeleryBackendByConnAndChannel(conn, channel)
+	backend.Host = host
+	backend.options = options
+	return backend, nil
+}
+
 // NewAMQPCeleryBackendByConnAndChannel creates new AMQPCeleryBackend by AMQP connection and channel
 func NewAMQPCeleryBackendByConnAndChannel(conn *amqp.Connection, channel *amqp.Channel) *AMQPCeleryBackend {
 	backend := &AMQPCeleryBackend{
@@ -38,12 +59,45 @@ func NewAMQPCeleryBackendByConnAndChannel(conn *amqp.Connection, channel *amqp.C
 // Reconnect reconnects to AMQP server
 func (b *AMQPCeleryBackend) Reconnect() {
 	b.Connection.Close()
-	conn, channel := NewAMQPConnection(b.Host)
+	var conn *amqp.Connection
+	var channel *amqp.Channel
+	if b.options != nil {
+		var err error
+		conn, channel, err = NewAMQPConnectionWithOptions(b.Host, b.options...)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		conn, channel = NewAMQPConnection(b.Host)
+	}
 	b.Channel = channel
 	b.Connection = conn
+	if b.confirmer != nil {
+		if err := b.EnableConfirms(b.confirmer.timeout); err != nil {
+			log.Printf("amqp_backend: failed to enable publisher confirms: %+v", err)
+		}
+	}
+}
+
+// EnableConfirms opens dedicated channel in publisher confirm mode on backend connection.
+// Once enabled, SetResult publishes results as mandatory and
+// blocks until AMQP server confirms the message or timeout is reached.
+func (b *AMQPCeleryBackend) EnableConfirms(timeout time.Duration) error {
+	confirmer, err := newAMQPConfirmer(b.Connection, timeout)
+	if err != nil {
+		return err
+	}
+	if b.confirmer != nil {
+		b.confirmer.channel.Close()
+	}
+	b.confirmer = confirmer
+	return nil
 }
 
-// GetResult retrieves result from AMQP queue
+// GetResult retrieves latest state of task from AMQP queue without waiting for messages.
+// Result queue holds message for each state of task reported by worker,
+// so that messages are taken from queue and state of unfinished task is kept
+// until next state is published. Results of finished tasks are returned only once.
 func (b *AMQPCeleryBackend) GetResult(taskID string) (*ResultMessage, error) {
 
 	queueName := strings.Replace(taskID, "-", "", -1)
@@ -75,20 +129,54 @@ func (b *AMQPCeleryBackend) GetResult(taskID string) (*ResultMessage, error) {
 		return nil, err
 	}
 
-	// open channel temporarily
-	channel, err := b.Consume(queueName, "", false, false, false, false, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var resultMessage ResultMessage
+	return b.latestResult(taskID, func() (amqp.Delivery, bool, error) {
+		return b.Get(queueName, true)
+	})
+}
 
-	delivery := <-channel
-	deliveryAck(delivery)
-	if err := json.Unmarshal(delivery.Body, &resultMessage); err != nil {
-		return nil, err
+// latestResult takes all available messages with get and returns the latest state of task
+func (b *AMQPCeleryBackend) latestResult(taskID string, get func() (amqp.Delivery, bool, error)) (*ResultMessage, error) {
+	b.statesLock.Lock()
+	defer b.statesLock.Unlock()
+	if b.states == nil {
+		b.states = map[string]*ResultMessage{}
 	}
-	return &resultMessage, nil
+	for {
+		delivery, ok, err := get()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		body, err := decompressHeader(delivery.Body, delivery.Headers["compression"])
+		if err != nil {
+			return nil, err
+		}
+		var resultMessage ResultMessage
+		if err := json.Unmarshal(body, &resultMessage); err != nil {
+			return nil, err
+		}
+		b.states[taskID] = &resultMessage
+	}
+	resultMessage, ok := b.states[taskID]
+	if !ok {
+		return nil, ErrResultNotAvailable
+	}
+	if isReadyState(resultMessage.Status) {
+		delete(b.states, taskID)
+	}
+	return resultMessage, nil
+}
+
+// ForgetResult deletes result queue of task
+func (b *AMQPCeleryBackend) ForgetResult(taskID string) error {
+	b.statesLock.Lock()
+	delete(b.states, taskID)
+	b.statesLock.Unlock()
+	queueName := strings.Replace(taskID, "-", "", -1)
+	_, err := b.QueueDelete(queueName, false, false, false)
+	return err
 }
 
 // SetResult sets result back to AMQP queue
@@ -139,6 +227,10 @@ func (b *AMQPCeleryBackend) SetResult(taskID string, result *ResultMessage) erro
 		ContentType:  "application/json",
 		Body:         resBytes,
 	}
+	if b.confirmer != nil {
+		message.MessageId = taskID
+		return b.confirmer.publish("", queueName, message)
+	}
 	return b.Publish(
 		"",
 		queueName,
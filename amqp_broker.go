@@ -5,7 +5,7 @@
 package gocelery
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 	"time"
 
@@ -54,6 +54,8 @@ type AMQPCeleryBroker struct {
 	Queue            *AMQPQueue
 	consumingChannel <-chan amqp.Delivery
 	Rate             int
+	confirmer        *amqpConfirmer
+	brokerSerializers
 }
 
 // NewAMQPConnection creates new AMQP channel
@@ -75,28 +77,52 @@ func NewAMQPCeleryBroker(host string) *AMQPCeleryBroker {
 	return NewAMQPCeleryBrokerByConnAndChannel(NewAMQPConnection(host))
 }
 
+// NewAMQPCeleryBrokerWithOptions creates new AMQPCeleryBroker connected with given options
+// such as TLS configuration and SASL EXTERNAL authentication
+func NewAMQPCeleryBrokerWithOptions(host string, options ...AMQPOption) (*AMQPCeleryBroker, error) {
+	conn, channel, err := NewAMQPConnectionWithOptions(host, options...)
+	if err != nil {
+		return nil, err
+	}
+	broker, err := newAMQPCeleryBroker(conn, channel, "celery")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return broker, nil
+}
+
 // NewAMQPCeleryBrokerByConnAndChannel creates new AMQPCeleryBroker using AMQP conn and channel
 func NewAMQPCeleryBrokerByConnAndChannel(conn *amqp.Connection, channel *amqp.Channel) *AMQPCeleryBroker {
+	broker, err := newAMQPCeleryBroker(conn, channel, "celery")
+	if err != nil {
+		panic(err)
+	}
+	return broker
+}
+
+// newAMQPCeleryBroker creates new AMQPCeleryBroker consuming given queue
+func newAMQPCeleryBroker(conn *amqp.Connection, channel *amqp.Channel, queueName string) (*AMQPCeleryBroker, error) {
 	broker := &AMQPCeleryBroker{
 		Channel:    channel,
 		Connection: conn,
 		Exchange:   NewAMQPExchange("default"),
-		Queue:      NewAMQPQueue("celery"),
+		Queue:      NewAMQPQueue(queueName),
 		Rate:       4,
 	}
 	if err := broker.CreateExchange(); err != nil {
-		panic(err)
+		return nil, err
 	}
 	if err := broker.CreateQueue(); err != nil {
-		panic(err)
+		return nil, err
 	}
 	if err := broker.Qos(broker.Rate, 0, false); err != nil {
-		panic(err)
+		return nil, err
 	}
 	if err := broker.StartConsumingChannel(); err != nil {
-		panic(err)
+		return nil, err
 	}
-	return broker
+	return broker, nil
 }
 
 // StartConsumingChannel spawns receiving channel on AMQP queue
@@ -109,10 +135,25 @@ func (b *AMQPCeleryBroker) StartConsumingChannel() error {
 	return nil
 }
 
+// EnableConfirms opens dedicated channel in publisher confirm mode on broker connection.
+// Once enabled, SendCeleryMessage publishes messages as mandatory and
+// blocks until AMQP server confirms the message or timeout is reached.
+// Messages that cannot be routed to any queue are returned as errors.
+func (b *AMQPCeleryBroker) EnableConfirms(timeout time.Duration) error {
+	confirmer, err := newAMQPConfirmer(b.Connection, timeout)
+	if err != nil {
+		return err
+	}
+	if b.confirmer != nil {
+		b.confirmer.channel.Close()
+	}
+	b.confirmer = confirmer
+	return nil
+}
+
 // SendCeleryMessage sends CeleryMessage to broker
 func (b *AMQPCeleryBroker) SendCeleryMessage(message *CeleryMessage) error {
-	taskMessage := message.GetTaskMessage()
-	queueName := "celery"
+	queueName := b.Queue.Name
 	_, err := b.QueueDeclare(
 		queueName, // name
 		true,      // durable
@@ -137,16 +178,27 @@ func (b *AMQPCeleryBroker) SendCeleryMessage(message *CeleryMessage) error {
 		return err
 	}
 
-	resBytes, err := json.Marshal(taskMessage)
+	// amqp messages carry serialized task message without base64 encoding
+	resBytes, err := base64.StdEncoding.DecodeString(message.Body)
 	if err != nil {
 		return err
 	}
 
 	publishMessage := amqp.Publishing{
-		DeliveryMode: amqp.Persistent,
-		Timestamp:    time.Now(),
-		ContentType:  "application/json",
-		Body:         resBytes,
+		DeliveryMode:    amqp.Persistent,
+		Timestamp:       time.Now(),
+		ContentType:     message.ContentType,
+		ContentEncoding: message.ContentEncoding,
+		Headers:         amqp.Table(message.Headers),
+		Body:            resBytes,
+	}
+
+	if b.confirmer != nil {
+		// messages which cannot be decoded are published with generated id
+		b.inspectTaskMessage(message, func(taskMessage *TaskMessage) {
+			publishMessage.MessageId = taskMessage.ID
+		})
+		return b.confirmer.publish("", queueName, publishMessage)
 	}
 
 	return b.Publish(
@@ -163,11 +215,19 @@ func (b *AMQPCeleryBroker) GetTaskMessage() (*TaskMessage, error) {
 	select {
 	case delivery := <-b.consumingChannel:
 		deliveryAck(delivery)
-		var taskMessage TaskMessage
-		if err := json.Unmarshal(delivery.Body, &taskMessage); err != nil {
+		contentType := delivery.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		serializer, err := b.getSerializer(contentType)
+		if err != nil {
+			return nil, err
+		}
+		body, err := decompressHeader(delivery.Body, delivery.Headers["compression"])
+		if err != nil {
 			return nil, err
 		}
-		return &taskMessage, nil
+		return decodeTaskMessageBody(body, serializer)
 	default:
 		return nil, fmt.Errorf("consuming channel is empty")
 	}
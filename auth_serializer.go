@@ -0,0 +1,322 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // default digest of celery auth serializer
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// authSeparator separates fields of signed celery auth serializer payload
+var authSeparator = []byte("\x00\x01")
+
+// AuthSerializer is compatible with celery auth serializer (application/data).
+// Messages serialized by Serializer are signed with private key of Cert
+// and verified against certificates of CertStore identified by issuer and serial number.
+type AuthSerializer struct {
+	// Serializer serializes signed messages, json by default
+	Serializer Serializer
+	// Key signs serialized messages and is required only for sending tasks
+	Key  *rsa.PrivateKey
+	Cert *x509.Certificate
+	// CertStore contains trusted certificates of task producers by signer id
+	CertStore map[string]*x509.Certificate
+	Digest    crypto.Hash
+}
+
+// NewAuthSerializer creates AuthSerializer from PEM encoded files like celery security settings.
+// keyFile and certFile are required for signing messages and may be empty for workers.
+// certStore is glob pattern or directory of trusted certificates.
+func NewAuthSerializer(keyFile, certFile, certStore string) (*AuthSerializer, error) {
+	s := &AuthSerializer{
+		Serializer: jsonSerializer{},
+		CertStore:  map[string]*x509.Certificate{},
+		Digest:     crypto.SHA256,
+	}
+	if keyFile != "" || certFile != "" {
+		key, err := loadRSAPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := loadCertificates(certFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("no certificate found in %s", certFile)
+		}
+		s.Key, s.Cert = key, certs[0]
+	}
+	if info, err := os.Stat(certStore); err == nil && info.IsDir() {
+		certStore = filepath.Join(certStore, "*")
+	}
+	paths, err := filepath.Glob(certStore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate store %s: %v", certStore, err)
+	}
+	// directories and files without certificates such as private keys are skipped
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			continue
+		}
+		certs, err := loadCertificates(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			s.CertStore[certificateID(cert)] = cert
+		}
+	}
+	if len(s.CertStore) == 0 {
+		return nil, fmt.Errorf("no certificates found in certificate store %s", certStore)
+	}
+	return s, nil
+}
+
+// ContentType returns content type of celery auth serializer
+func (s *AuthSerializer) ContentType() string {
+	return "application/data"
+}
+
+// ContentEncoding returns content encoding of celery auth serializer
+func (s *AuthSerializer) ContentEncoding() string {
+	return "utf-8"
+}
+
+// Marshal serializes and signs v
+func (s *AuthSerializer) Marshal(v interface{}) ([]byte, error) {
+	if s.Key == nil || s.Cert == nil {
+		return nil, fmt.Errorf("auth serializer requires private key and certificate to sign messages")
+	}
+	body, err := s.Serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// serialized body is signed, so that receiver verifies it before decoding
+	hashed, err := s.digest(body)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := rsa.SignPSS(rand.Reader, s.Key, s.Digest, hashed, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthAuto,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign message: %v", err)
+	}
+	payload := bytes.Join([][]byte{
+		[]byte(certificateID(s.Cert)),
+		signature,
+		[]byte(s.Serializer.ContentType()),
+		[]byte(s.Serializer.ContentEncoding()),
+		body,
+	}, authSeparator)
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(payload)))
+	base64.StdEncoding.Encode(encoded, payload)
+	return encoded, nil
+}
+
+// Unmarshal verifies signature of data against certificate store and deserializes it into v
+func (s *AuthSerializer) Unmarshal(data []byte, v interface{}) error {
+	payload := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(payload, data)
+	if err != nil {
+		return fmt.Errorf("unable to deserialize signed message: %v", err)
+	}
+	payload = payload[:n]
+	i := bytes.Index(payload, authSeparator)
+	if i < 0 {
+		return fmt.Errorf("unable to deserialize signed message: missing signer")
+	}
+	signer := string(payload[:i])
+	cert, err := s.signerCertificate(signer)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate of signer %s has no rsa public key", signer)
+	}
+	// signature may contain separator, so its length is given by key size
+	start := i + len(authSeparator)
+	end := start + publicKey.Size()
+	if end+len(authSeparator) > len(payload) {
+		return fmt.Errorf("unable to deserialize signed message: truncated signature")
+	}
+	signature := payload[start:end]
+	fields := bytes.SplitN(payload[end+len(authSeparator):], authSeparator, 3)
+	if len(fields) != 3 {
+		return fmt.Errorf("unable to deserialize signed message: missing fields")
+	}
+	contentType, body := string(fields[0]), fields[2]
+	hashed, err := s.digest(body)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPSS(publicKey, s.Digest, hashed, signature, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthAuto,
+	}); err != nil {
+		return fmt.Errorf("bad signature of signer %s: %v", signer, err)
+	}
+	serializer := s.Serializer
+	if contentType != serializer.ContentType() {
+		if serializer, err = GetSerializer(contentType); err != nil {
+			return err
+		}
+	}
+	return serializer.Unmarshal(body, v)
+}
+
+// signerCertificate returns trusted certificate of signer.
+// Signers not found by id are matched by serial number, since issuer names
+// may be formatted differently by python.
+func (s *AuthSerializer) signerCertificate(signer string) (*x509.Certificate, error) {
+	if cert, ok := s.CertStore[signer]; ok {
+		return cert, nil
+	}
+	if i := strings.LastIndex(signer, " "); i >= 0 {
+		serial := signer[i+1:]
+		for _, cert := range s.CertStore {
+			if cert.SerialNumber.String() == serial {
+				return cert, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown signer %s", signer)
+}
+
+// digest hashes data with digest of serializer
+func (s *AuthSerializer) digest(data []byte) ([]byte, error) {
+	if !s.Digest.Available() {
+		return nil, fmt.Errorf("unavailable digest %v", s.Digest)
+	}
+	h := s.Digest.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// certificateID returns id of certificate in the same format as celery, i.e. repr of
+// issuer name of python cryptography followed by serial number. Unlike pkix.Name.String,
+// attributes are formatted in order of raw issuer with short names of python cryptography.
+func certificateID(cert *x509.Certificate) string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(cert.RawIssuer, &rdns); err != nil {
+		rdns = cert.Issuer.ToRDNSequence()
+	}
+	names := make([]string, len(rdns))
+	for i, rdn := range rdns {
+		attributes := make([]string, len(rdn))
+		for j, attribute := range rdn {
+			name, ok := pythonNameAttributes[attribute.Type.String()]
+			if !ok {
+				name = attribute.Type.String()
+			}
+			attributes[j] = name + "=" + escapePythonNameValue(fmt.Sprint(attribute.Value))
+		}
+		names[i] = strings.Join(attributes, "+")
+	}
+	return fmt.Sprintf("<Name(%s)> %s", strings.Join(names, ","), cert.SerialNumber.String())
+}
+
+// pythonNameAttributes are short names of name attributes used by python cryptography,
+// other attributes are named by their dotted oid
+var pythonNameAttributes = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.6":                    "C",
+	"2.5.4.9":                    "STREET",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"0.9.2342.19200300.100.1.1":  "UID",
+}
+
+// escapePythonNameValue escapes value of name attribute like python cryptography
+func escapePythonNameValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	value = strings.NewReplacer(
+		`\`, `\\`, `"`, `\"`, "+", `\+`, ",", `\,`, ";", `\;`, "<", `\<`, ">", `\>`, "\x00", `\00`,
+	).Replace(value)
+	if value[0] == '#' || value[0] == ' ' {
+		value = `\` + value
+	}
+	if value[len(value)-1] == ' ' {
+		value = value[:len(value)-1] + `\ `
+	}
+	return value
+}
+
+// loadCertificates loads PEM encoded certificates of file refusing expired certificates
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate %s: %v", path, err)
+		}
+		if time.Now().After(cert.NotAfter) {
+			return nil, fmt.Errorf("expired certificate %s", certificateID(cert))
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// loadRSAPrivateKey loads PEM encoded PKCS #1 or PKCS #8 rsa private key
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var block *pem.Block
+	for {
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no private key found in %s", path)
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %v", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not rsa key", path)
+	}
+	return rsaKey, nil
+}
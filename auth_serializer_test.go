@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// writeTestSigningCertificate writes rsa private key and self-signed certificate with given serial number to dir
+func writeTestSigningCertificate(dir string, serial int64) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gocelery", Organization: []string{"gocelery"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyFile := filepath.Join(dir, fmt.Sprintf("key%d.pem", serial))
+	certFile := filepath.Join(dir, fmt.Sprintf("cert%d.pem", serial))
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return "", "", err
+	}
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		return "", "", err
+	}
+	return keyFile, certFile, nil
+}
+
+// TestAuthSerializer tests signing and verification of task messages
+func TestAuthSerializer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile, certFile, err := writeTestSigningCertificate(dir, 1)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	untrustedDir := filepath.Join(dir, "untrusted")
+	if err := os.Mkdir(untrustedDir, 0700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	untrustedKeyFile, untrustedCertFile, err := writeTestSigningCertificate(untrustedDir, 2)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	serializer, err := NewAuthSerializer(keyFile, certFile, filepath.Join(dir, "cert*.pem"))
+	if err != nil {
+		t.Fatalf("failed to create auth serializer: %v", err)
+	}
+	taskMessage := getTaskMessage("add")
+	taskMessage.Args = []interface{}{1, 2}
+	data, err := serializer.Marshal(taskMessage)
+	releaseTaskMessage(taskMessage)
+	if err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+	var decoded TaskMessage
+	if err := serializer.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to verify signed message: %v", err)
+	}
+	if decoded.Task != "add" || len(decoded.Args) != 2 {
+		t.Errorf("received unexpected task message %+v", decoded)
+	}
+
+	// tampered body fails verification
+	payload, _ := base64.StdEncoding.DecodeString(string(data))
+	tampered := bytes.Replace(payload, []byte(`"args":[1,2]`), []byte(`"args":[1,3]`), 1)
+	if bytes.Equal(tampered, payload) {
+		t.Fatalf("failed to tamper signed message")
+	}
+	if err := serializer.Unmarshal([]byte(base64.StdEncoding.EncodeToString(tampered)), &decoded); err == nil {
+		t.Errorf("expected tampered message to be rejected")
+	}
+
+	// messages of signers outside of certificate store are rejected
+	untrusted, err := NewAuthSerializer(untrustedKeyFile, untrustedCertFile, untrustedDir)
+	if err != nil {
+		t.Fatalf("failed to create auth serializer: %v", err)
+	}
+	data, err = untrusted.Marshal(map[string]interface{}{"task": "add"})
+	if err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+	if err := serializer.Unmarshal(data, &decoded); err == nil {
+		t.Errorf("expected message of untrusted signer to be rejected")
+	}
+
+	// workers without private key verify messages but cannot sign them
+	verifier, err := NewAuthSerializer("", "", dir)
+	if err != nil {
+		t.Fatalf("failed to create auth serializer: %v", err)
+	}
+	if _, err := verifier.Marshal(map[string]interface{}{}); err == nil {
+		t.Errorf("expected signing without private key to fail")
+	}
+}
+
+// TestAuthSerializerClient tests that workers with security enabled run only signed tasks
+func TestAuthSerializerClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile, certFile, err := writeTestSigningCertificate(dir, 1)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	broker := NewMemoryBroker()
+	backend := NewMemoryBackend()
+	client, _ := NewCeleryClient(broker, backend, 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	client.Register(taskName, add)
+
+	// unsigned message sent before security is enabled is refused
+	if _, err := client.Delay(taskName, 1, 2); err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	if err := client.SetupSecurity(keyFile, certFile, dir); err != nil {
+		t.Fatalf("failed to set up security: %v", err)
+	}
+	// auth serializer is not shared with other clients of process
+	if _, err := GetSerializer("application/data"); err == nil {
+		t.Errorf("expected auth serializer not to be registered globally")
+	}
+	otherDir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(otherDir)
+	otherKeyFile, otherCertFile, err := writeTestSigningCertificate(otherDir, 2)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	otherClient, _ := NewCeleryClient(NewMemoryBroker(), NewMemoryBackend(), 1)
+	if err := otherClient.SetupSecurity(otherKeyFile, otherCertFile, otherDir); err != nil {
+		t.Fatalf("failed to set up security of other client: %v", err)
+	}
+	taskMessage, err := broker.GetTaskMessage()
+	if err != nil || taskMessage == nil {
+		t.Fatalf("failed to get task message: %v", err)
+	}
+	if _, err := client.worker.RunTask(taskMessage); err == nil {
+		t.Errorf("expected unsigned task message to be refused")
+	}
+
+	asyncResult, err := client.Delay(taskName, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartWorkerWithContext(ctx)
+	defer client.StopWorker()
+	res, err := asyncResult.Get(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if fmt.Sprint(res) != "3" {
+		t.Errorf("expected result 3 but received %v", res)
+	}
+}
+
+// TestAuthSerializerCertificateID tests that signer ids match ids of python celery,
+// which are repr of issuer name of python cryptography followed by serial number
+func TestAuthSerializerCertificateID(t *testing.T) {
+	certs, err := loadCertificates(filepath.Join("testdata", "signer_cert.pem"))
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	expected := `<Name(C=US,O=acme\, inc,CN=gocelery,1.2.840.113549.1.9.1=celery@example.com)> 4242`
+	if id := certificateID(certs[0]); id != expected {
+		t.Errorf("expected signer id %s but received %s", expected, id)
+	}
+	if cert, err := (&AuthSerializer{CertStore: map[string]*x509.Certificate{expected: certs[0]}}).signerCertificate(expected); err != nil || cert != certs[0] {
+		t.Errorf("failed to find certificate of python signer: %v", err)
+	}
+}
@@ -5,13 +5,23 @@
 package gocelery
 
 import (
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	_ "github.com/mattn/go-sqlite3"
 	uuid "github.com/satori/go.uuid"
+	"github.com/streadway/amqp"
 )
 
 // TestBackendRedisGetResult is Redis specific test to get result from backend
@@ -127,6 +137,10 @@ func TestBackendSetGetResult(t *testing.T) {
 			name:    "set/get result to redis backend with connection",
 			backend: redisBackendWithConn,
 		},
+		{
+			name:    "set/get result to memory backend",
+			backend: NewMemoryBackend(),
+		},
 		{
 			name:    "set/get result to amqp backend",
 			backend: amqpBackend,
@@ -154,3 +168,326 @@ func TestBackendSetGetResult(t *testing.T) {
 		releaseResultMessage(resultMessage)
 	}
 }
+
+// TestBackendFromURL tests creation of backends from celery-style urls
+func TestBackendFromURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	testCases := []struct {
+		name string
+		uri  string
+	}{
+		{
+			name: "redis backend url",
+			uri:  "redis://localhost:6379/0",
+		},
+		{
+			name: "memory backend url",
+			uri:  "cache+memory://",
+		},
+		{
+			name: "file backend url",
+			uri:  "file://" + filepath.Join(dir, "results"),
+		},
+	}
+	for _, tc := range testCases {
+		backend, err := NewBackendFromURL(tc.uri)
+		if err != nil {
+			t.Errorf("test '%s': failed to create backend from url: %v", tc.name, err)
+			continue
+		}
+		taskID := uuid.Must(uuid.NewV4()).String()
+		resultMessage := getResultMessage(rand.Float64())
+		if err := backend.SetResult(taskID, resultMessage); err != nil {
+			t.Errorf("test '%s': error setting result to backend: %v", tc.name, err)
+			releaseResultMessage(resultMessage)
+			continue
+		}
+		res, err := backend.GetResult(taskID)
+		if err != nil {
+			t.Errorf("test '%s': error getting result from backend: %v", tc.name, err)
+			releaseResultMessage(resultMessage)
+			continue
+		}
+		if !reflect.DeepEqual(res, resultMessage) {
+			t.Errorf("test '%s': result message received %v is different from original %v", tc.name, res, resultMessage)
+		}
+		releaseResultMessage(resultMessage)
+	}
+	for _, uri := range []string{"rpc://", "file://", "unknown://localhost"} {
+		if _, err := NewBackendFromURL(uri); err == nil {
+			t.Errorf("expected error creating backend from url %q", uri)
+		}
+	}
+
+	// schemes of backends in other packages are registered when packages are imported
+	if _, err := NewBackendFromURL("mongodb://localhost:27017"); err == nil || !strings.Contains(err.Error(), "celerymongo") {
+		t.Errorf("expected error naming package of mongodb backend but received %v", err)
+	}
+	memoryBackend := NewMemoryBackend()
+	RegisterBackendURLScheme("registered", func(uri string, u *url.URL, query url.Values) (CeleryBackend, error) {
+		return memoryBackend, nil
+	})
+	if backend, err := NewBackendFromURL("registered://localhost"); err != nil || backend != memoryBackend {
+		t.Errorf("expected registered backend but received %v: %v", backend, err)
+	}
+}
+
+// TestBackendFile tests that file backend stores results in celery file backend layout
+func TestBackendFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	backend, err := NewFileBackend(filepath.Join(dir, "results"))
+	if err != nil {
+		t.Fatalf("failed to create file backend: %v", err)
+	}
+	taskID := uuid.Must(uuid.NewV4()).String()
+	if _, err := backend.GetResult(taskID); err == nil {
+		t.Errorf("expected error getting result of unknown task")
+	}
+	resultMessage := getResultMessage("result")
+	defer releaseResultMessage(resultMessage)
+	if err := backend.SetResult(taskID, resultMessage); err != nil {
+		t.Fatalf("error setting result to backend: %v", err)
+	}
+	resBytes, err := ioutil.ReadFile(filepath.Join(dir, "results", "celery-task-meta-"+taskID))
+	if err != nil {
+		t.Fatalf("failed to read result file: %v", err)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(resBytes, &meta); err != nil {
+		t.Fatalf("failed to decode result file: %v", err)
+	}
+	if meta["status"] != "SUCCESS" || meta["result"] != "result" {
+		t.Errorf("unexpected result file content %s", resBytes)
+	}
+	res, err := backend.GetResult(taskID)
+	if err != nil {
+		t.Fatalf("error getting result from backend: %v", err)
+	}
+	if !reflect.DeepEqual(res, resultMessage) {
+		t.Errorf("result message received %v is different from original %v", res, resultMessage)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "results"))
+	if err != nil {
+		t.Fatalf("failed to list result directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected single result file but found %d files", len(files))
+	}
+}
+
+// TestBackendAMQPLatestResult tests that states of tasks are taken from result queues without blocking
+func TestBackendAMQPLatestResult(t *testing.T) {
+	backend := &AMQPCeleryBackend{}
+	taskID := uuid.Must(uuid.NewV4()).String()
+	var queue []amqp.Delivery
+	get := func() (amqp.Delivery, bool, error) {
+		if len(queue) == 0 {
+			return amqp.Delivery{}, false, nil
+		}
+		delivery := queue[0]
+		queue = queue[1:]
+		return delivery, true, nil
+	}
+	publish := func(status string) {
+		resBytes, err := json.Marshal(&ResultMessage{ID: taskID, Status: status})
+		if err != nil {
+			t.Fatalf("failed to encode result: %v", err)
+		}
+		queue = append(queue, amqp.Delivery{Body: resBytes})
+	}
+
+	if _, err := backend.latestResult(taskID, get); err != ErrResultNotAvailable {
+		t.Errorf("expected result of unknown task not to be available but received %v", err)
+	}
+	publish(StateReceived)
+	publish(StateStarted)
+	for i := 0; i < 2; i++ {
+		res, err := backend.latestResult(taskID, get)
+		if err != nil || res.Status != StateStarted {
+			t.Errorf("expected latest state of task to be kept but received %+v: %v", res, err)
+		}
+	}
+	publish(StateSuccess)
+	res, err := backend.latestResult(taskID, get)
+	if err != nil || res.Status != StateSuccess {
+		t.Errorf("expected result of finished task but received %+v: %v", res, err)
+	}
+	if _, err := backend.latestResult(taskID, get); err != ErrResultNotAvailable {
+		t.Errorf("expected result of finished task to be returned once but received %v", err)
+	}
+}
+
+// newSQLiteBackend creates SQLCeleryBackend on temporary sqlite database
+func newSQLiteBackend(t *testing.T) (*SQLCeleryBackend, func()) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "results.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	backend, err := NewSQLBackend(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("failed to create sql backend: %v", err)
+	}
+	if err := backend.Migrate(); err != nil {
+		t.Fatalf("failed to migrate sql backend: %v", err)
+	}
+	return backend, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// TestBackendSQL tests set/get result, groups and cleanup of sql backend
+func TestBackendSQL(t *testing.T) {
+	backend, cleanup := newSQLiteBackend(t)
+	defer cleanup()
+
+	// migration is idempotent
+	if err := backend.Migrate(); err != nil {
+		t.Fatalf("failed to migrate sql backend again: %v", err)
+	}
+
+	taskID := uuid.Must(uuid.NewV4()).String()
+	for _, result := range []interface{}{
+		rand.Float64(),
+		map[string]interface{}{"a": []interface{}{1.0, "b", nil, true}},
+	} {
+		resultMessage := getResultMessage(result)
+		resultMessage.DateDone = time.Now().UTC().Truncate(time.Millisecond).Format(CeleryTimeLayout)
+		if err := backend.SetResult(taskID, resultMessage); err != nil {
+			t.Fatalf("error setting result to backend: %v", err)
+		}
+		res, err := backend.GetResult(taskID)
+		if err != nil {
+			t.Fatalf("error getting result from backend: %v", err)
+		}
+		resultMessage.ID = taskID
+		if !reflect.DeepEqual(res, resultMessage) {
+			t.Errorf("result message received %v is different from original %v", res, resultMessage)
+		}
+		releaseResultMessage(resultMessage)
+	}
+	if _, err := backend.GetResult(uuid.Must(uuid.NewV4()).String()); err == nil {
+		t.Errorf("expected error getting unknown result")
+	}
+
+	groupID := uuid.Must(uuid.NewV4()).String()
+	taskIDs := []string{taskID, uuid.Must(uuid.NewV4()).String()}
+	if err := backend.SaveGroup(groupID, taskIDs); err != nil {
+		t.Fatalf("error saving group: %v", err)
+	}
+	groupTaskIDs, err := backend.GetGroup(groupID)
+	if err != nil {
+		t.Fatalf("error getting group: %v", err)
+	}
+	if !reflect.DeepEqual(groupTaskIDs, taskIDs) {
+		t.Errorf("group task ids %v are different from original %v", groupTaskIDs, taskIDs)
+	}
+	if err := backend.DeleteGroup(groupID); err != nil {
+		t.Fatalf("error deleting group: %v", err)
+	}
+	if _, err := backend.GetGroup(groupID); err == nil {
+		t.Errorf("expected error getting deleted group")
+	}
+
+	deleted, err := backend.Cleanup()
+	if err != nil || deleted != 0 {
+		t.Errorf("expected no expired results but deleted %d: %v", deleted, err)
+	}
+	backend.Expires = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	deleted, err = backend.Cleanup()
+	if err != nil || deleted != 1 {
+		t.Errorf("expected single expired result but deleted %d: %v", deleted, err)
+	}
+}
+
+// TestBackendSQLPickle tests decoding of results pickled by python celery
+func TestBackendSQLPickle(t *testing.T) {
+	// pickle.dumps({'a': [1, 2.5, 'x', None, True, (1, 2)],
+	//     'b': {'c': -7, 'big': 2**40, 'neg': -300000}, 's': 'héllo'}, protocol=N)
+	expected := map[string]interface{}{
+		"a": []interface{}{1.0, 2.5, "x", nil, true, []interface{}{1.0, 2.0}},
+		"b": map[string]interface{}{"c": -7.0, "big": float64(1 << 40), "neg": -300000.0},
+		"s": "héllo",
+	}
+	for protocol, pickled := range map[int]string{
+		0: "286470300a56610a70310a286c70320a49310a6146322e350a6156780a70330a614e614930310a612849310a49320a7470340a617356620a70350a286470360a56630a70370a492d370a73566269670a70380a4c313039393531313632373737364c0a73566e65670a70390a492d3330303030300a737356730a7031300a5668e96c6c6f0a7031310a732e",
+		2: "80027d71002858010000006171015d7102284b0147400400000000000058010000007871034e884b014b028671046558010000006271057d71062858010000006371074af9ffffff580300000062696771088a0600000000000158030000006e656771094a206cfbff75580100000073710a580600000068c3a96c6c6f710b752e",
+		4: "8004955b000000000000007d94288c0161945d94284b014740040000000000008c0178944e884b014b028694658c0162947d94288c0163944af9ffffff8c03626967948a060000000000018c036e6567944a206cfbff758c0173948c0668c3a96c6c6f94752e",
+	} {
+		data, err := hex.DecodeString(pickled)
+		if err != nil {
+			t.Fatalf("malformed test pickle: %v", err)
+		}
+		val, err := PickleLoads(data)
+		if err != nil {
+			t.Errorf("failed to unpickle protocol %d: %v", protocol, err)
+			continue
+		}
+		if !reflect.DeepEqual(val, expected) {
+			t.Errorf("unpickled protocol %d value %v is different from expected %v", protocol, val, expected)
+		}
+	}
+
+	// values pickled by go are unpickled to the same json-compatible values
+	data, err := pickleDumps(map[string]interface{}{
+		"a": []int{1, -300000, 1 << 40},
+		"b": struct {
+			C string `json:"c"`
+		}{"d"},
+	})
+	if err != nil {
+		t.Fatalf("failed to pickle value: %v", err)
+	}
+	val, err := PickleLoads(data)
+	if err != nil {
+		t.Fatalf("failed to unpickle value: %v", err)
+	}
+	expected = map[string]interface{}{
+		"a": []interface{}{1.0, -300000.0, float64(1 << 40)},
+		"b": map[string]interface{}{"c": "d"},
+	}
+	if !reflect.DeepEqual(val, expected) {
+		t.Errorf("unpickled value %v is different from expected %v", val, expected)
+	}
+
+	// malformed and truncated pickles are rejected without panicking
+	malformed := []string{"NN(00t.", "(0t.", "N1.", "(NNs.", "\x85.", "0.", "."}
+	pickled, err := hex.DecodeString("80027d71002858010000006171015d7102284b0147400400000000000058010000007871034e884b014b028671046558010000006271057d71062858010000006371074af9ffffff580300000062696771088a0600000000000158030000006e656771094a206cfbff75580100000073710a580600000068c3a96c6c6f710b752e")
+	if err != nil {
+		t.Fatalf("malformed test pickle: %v", err)
+	}
+	for i := 0; i < len(pickled); i++ {
+		malformed = append(malformed, string(pickled[:i]))
+	}
+	for _, data := range malformed {
+		if val, err := PickleLoads([]byte(data)); err == nil {
+			t.Errorf("expected error unpickling malformed pickle %q but received %v", data, val)
+		}
+	}
+
+	// pickled python objects are reported with serializer to use instead
+	for name, data := range map[string]string{
+		// pickle.dumps(datetime.datetime(2021, 1, 1), protocol=2)
+		"datetime.datetime": "\x80\x02cdatetime\ndatetime\nq\x00C\n\x07\xe5\x01\x01\x00\x00\x00\x00\x00\x00q\x01\x85q\x02Rq\x03.",
+		// pickle.dumps(decimal.Decimal('1.5'), protocol=4)
+		"decimal.Decimal": "\x80\x04\x95\x1f\x00\x00\x00\x00\x00\x00\x00\x8c\x07decimal\x94\x8c\x07Decimal\x94\x93\x94\x8c\x031.5\x94\x85\x94R\x94.",
+	} {
+		_, err := PickleLoads([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), name) || !strings.Contains(err.Error(), "result_serializer='json'") {
+			t.Errorf("expected error naming %s and json result serializer but received %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+/*
+Package celerykafka provides gocelery broker for kafka.
+
+Importing it registers kafka://host1:9092,host2:9092 urls of gocelery.NewBrokerFromURL.
+Consumer group of workers is given by group_id query option.
+
+	import _ "github.com/gocelery/gocelery/celerykafka"
+
+	broker, err := gocelery.NewBrokerFromURL("kafka://localhost:9092?group_id=workers")
+*/
+package celerykafka
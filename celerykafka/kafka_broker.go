@@ -0,0 +1,234 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerykafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaBroker is celery broker for kafka.
+// Celery queues are mapped to topics and workers of a queue share consumer group.
+// Offsets are committed only after tasks are executed, so that messages of crashed
+// workers are delivered again, providing at-least-once delivery.
+// It is not compatible with python celery and is meant for go-only deployments.
+type KafkaBroker struct {
+	Brokers   []string
+	QueueName string
+	GroupID   string
+	// PartitionKey returns partition key of task message (nil distributes messages evenly).
+	// Messages with the same key are delivered in order.
+	PartitionKey func(*gocelery.TaskMessage) []byte
+	// FetchTimeout is time GetTaskMessage waits for message to arrive
+	FetchTimeout time.Duration
+
+	lock    sync.Mutex
+	writer  *kafka.Writer
+	reader  *kafka.Reader
+	offsets map[int]*kafkaPartitionOffsets
+	pending sync.Map
+	gocelery.BrokerSerializers
+}
+
+// kafkaPartitionOffsets tracks offsets of partition fetched but not yet committed
+type kafkaPartitionOffsets struct {
+	fetched []int64
+	done    map[int64]bool
+	last    int64
+}
+
+// NewKafkaBroker creates new KafkaBroker with given kafka broker addresses
+func NewKafkaBroker(brokers []string) *KafkaBroker {
+	return &KafkaBroker{
+		Brokers:      brokers,
+		QueueName:    "celery",
+		GroupID:      "gocelery",
+		FetchTimeout: 100 * time.Millisecond,
+		offsets:      map[int]*kafkaPartitionOffsets{},
+	}
+}
+
+// KafkaKwargPartitionKey returns PartitionKey using value of given task keyword argument,
+// so that tasks of the same entity are executed in order
+func KafkaKwargPartitionKey(name string) func(*gocelery.TaskMessage) []byte {
+	return func(message *gocelery.TaskMessage) []byte {
+		val, ok := message.Kwargs[name]
+		if !ok || val == nil {
+			return nil
+		}
+		return []byte(fmt.Sprint(val))
+	}
+}
+
+// SendCeleryMessage produces CeleryMessage to topic of queue
+func (b *KafkaBroker) SendCeleryMessage(message *gocelery.CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	msg := kafka.Message{
+		Value: jsonBytes,
+	}
+	if b.PartitionKey != nil {
+		err := b.InspectTaskMessage(message, func(taskMessage *gocelery.TaskMessage) {
+			msg.Key = b.PartitionKey(taskMessage)
+		})
+		if err != nil {
+			return fmt.Errorf("partition key: %v", err)
+		}
+	}
+	return b.getWriter().WriteMessages(context.Background(), msg)
+}
+
+// GetTaskMessage retrieves task message from topic waiting at most FetchTimeout
+func (b *KafkaBroker) GetTaskMessage() (*gocelery.TaskMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.FetchTimeout)
+	defer cancel()
+	return b.GetTaskMessageWithContext(ctx)
+}
+
+// GetTaskMessageWithContext waits for task message to arrive until context is done
+func (b *KafkaBroker) GetTaskMessageWithContext(ctx context.Context) (*gocelery.TaskMessage, error) {
+	reader := b.getReader()
+	msg, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.fetched(msg)
+
+	var message gocelery.CeleryMessage
+	err = json.Unmarshal(msg.Value, &message)
+	var taskMessage *gocelery.TaskMessage
+	if err == nil {
+		if taskMessage = b.DecodeTaskMessage(&message); taskMessage == nil {
+			err = fmt.Errorf("failed to decode task message at offset %d of partition %d", msg.Offset, msg.Partition)
+		}
+	}
+	if err != nil {
+		// malformed messages can never be processed
+		if commitErr := b.commit(ctx, msg); commitErr != nil {
+			return nil, commitErr
+		}
+		return nil, err
+	}
+	b.pending.Store(taskMessage.ID, msg)
+	return taskMessage, nil
+}
+
+// AckTaskMessage marks message of executed task as processed.
+// Offset of partition is committed once all preceding messages of partition are processed.
+func (b *KafkaBroker) AckTaskMessage(message *gocelery.TaskMessage) error {
+	msg, ok := b.pending.Load(message.ID)
+	if !ok {
+		return fmt.Errorf("no pending kafka message for task %s", message.ID)
+	}
+	if err := b.commit(context.Background(), msg.(kafka.Message)); err != nil {
+		return err
+	}
+	b.pending.Delete(message.ID)
+	return nil
+}
+
+// Close closes kafka reader and writer
+func (b *KafkaBroker) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var err error
+	if b.reader != nil {
+		err = b.reader.Close()
+		b.reader = nil
+		b.offsets = map[int]*kafkaPartitionOffsets{}
+	}
+	if b.writer != nil {
+		if writerErr := b.writer.Close(); err == nil {
+			err = writerErr
+		}
+		b.writer = nil
+	}
+	return err
+}
+
+// fetched tracks offset of fetched message until it is committed.
+// Partition revoked in rebalance is consumed again from its committed offset
+// when it is assigned back, so offsets fetched before rebalance are dropped.
+func (b *KafkaBroker) fetched(msg kafka.Message) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	offsets, ok := b.offsets[msg.Partition]
+	if !ok || msg.Offset <= offsets.last {
+		offsets = &kafkaPartitionOffsets{done: map[int64]bool{}}
+		b.offsets[msg.Partition] = offsets
+	}
+	offsets.fetched = append(offsets.fetched, msg.Offset)
+	offsets.last = msg.Offset
+}
+
+// commit marks message as processed and commits highest offset
+// of partition preceded only by processed messages
+func (b *KafkaBroker) commit(ctx context.Context, msg kafka.Message) error {
+	b.lock.Lock()
+	offsets, ok := b.offsets[msg.Partition]
+	if !ok {
+		b.lock.Unlock()
+		return fmt.Errorf("offset %d of partition %d was not fetched", msg.Offset, msg.Partition)
+	}
+	if len(offsets.fetched) == 0 || msg.Offset < offsets.fetched[0] {
+		// message was fetched before partition was revoked and is delivered again
+		b.lock.Unlock()
+		return nil
+	}
+	offsets.done[msg.Offset] = true
+	commitOffset := int64(-1)
+	for len(offsets.fetched) > 0 && offsets.done[offsets.fetched[0]] {
+		commitOffset = offsets.fetched[0]
+		delete(offsets.done, commitOffset)
+		offsets.fetched = offsets.fetched[1:]
+	}
+	reader := b.reader
+	b.lock.Unlock()
+	if commitOffset < 0 || reader == nil {
+		return nil
+	}
+	msg.Offset = commitOffset
+	return reader.CommitMessages(ctx, msg)
+}
+
+func (b *KafkaBroker) getWriter() *kafka.Writer {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.writer == nil {
+		b.writer = &kafka.Writer{
+			Addr:                   kafka.TCP(b.Brokers...),
+			Topic:                  b.QueueName,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+			// tasks are sent one by one, so waiting for batch to fill only adds latency
+			BatchTimeout: 10 * time.Millisecond,
+		}
+	}
+	return b.writer
+}
+
+func (b *KafkaBroker) getReader() *kafka.Reader {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reader == nil {
+		b.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     b.Brokers,
+			GroupID:     b.GroupID,
+			Topic:       b.QueueName,
+			StartOffset: kafka.FirstOffset,
+			MaxWait:     time.Second,
+		})
+	}
+	return b.reader
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerykafka
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	uuid "github.com/satori/go.uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// newCeleryMessage creates celery message of task message encoded as by python celery
+func newCeleryMessage(taskMessage *gocelery.TaskMessage) (*gocelery.CeleryMessage, error) {
+	encodedTaskMessage, err := taskMessage.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &gocelery.CeleryMessage{
+		Body:            encodedTaskMessage,
+		ContentType:     "application/json",
+		ContentEncoding: "utf-8",
+		Properties: gocelery.CeleryProperties{
+			BodyEncoding: "base64",
+			DeliveryInfo: gocelery.CeleryDeliveryInfo{
+				RoutingKey: "celery",
+				Exchange:   "celery",
+			},
+			DeliveryMode: 2,
+			DeliveryTag:  uuid.Must(uuid.NewV4()).String(),
+		},
+	}, nil
+}
+
+// newTaskMessage creates task message of add task with given arguments
+func newTaskMessage(args ...interface{}) *gocelery.TaskMessage {
+	return &gocelery.TaskMessage{
+		ID:     uuid.Must(uuid.NewV4()).String(),
+		Task:   "add",
+		Args:   args,
+		Kwargs: map[string]interface{}{},
+	}
+}
+
+// TestBrokerKafka tests keyed ordering and offset commits of kafka broker
+func TestBrokerKafka(t *testing.T) {
+	queueName := uuid.Must(uuid.NewV4()).String()
+	newBroker := func() *KafkaBroker {
+		broker := NewKafkaBroker([]string{"localhost:9092"})
+		broker.QueueName = queueName
+		broker.PartitionKey = KafkaKwargPartitionKey("user")
+		return broker
+	}
+	receive := func(broker *KafkaBroker, n int) []*gocelery.TaskMessage {
+		var messages []*gocelery.TaskMessage
+		for len(messages) < n {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			message, err := broker.GetTaskMessageWithContext(ctx)
+			cancel()
+			if err != nil {
+				t.Fatalf("failed to get celery message from broker: %v", err)
+			}
+			messages = append(messages, message)
+		}
+		return messages
+	}
+
+	producer := newBroker()
+	defer producer.Close()
+	var taskIDs []string
+	for i := 0; i < 3; i++ {
+		taskMessage := newTaskMessage(i, i)
+		taskMessage.Kwargs["user"] = "gopher"
+		taskIDs = append(taskIDs, taskMessage.ID)
+		celeryMessage, err := newCeleryMessage(taskMessage)
+		if err != nil {
+			t.Fatalf("failed to encode task message: %v", err)
+		}
+		if err := producer.SendCeleryMessage(celeryMessage); err != nil {
+			t.Fatalf("failed to send celery message to broker: %v", err)
+		}
+	}
+
+	// messages with the same partition key are received in order
+	consumer := newBroker()
+	messages := receive(consumer, 3)
+	for i, message := range messages {
+		if message.ID != taskIDs[i] {
+			t.Errorf("expected message %d to be task %s but received %s", i, taskIDs[i], message.ID)
+		}
+	}
+	// offset is not committed while first message is being processed
+	for _, message := range messages[1:] {
+		if err := consumer.AckTaskMessage(message); err != nil {
+			t.Fatalf("failed to acknowledge message: %v", err)
+		}
+	}
+	consumer.Close()
+
+	consumer = newBroker()
+	messages = receive(consumer, 3)
+	if messages[0].ID != taskIDs[0] {
+		t.Errorf("expected unacknowledged task %s to be redelivered but received %s", taskIDs[0], messages[0].ID)
+	}
+	for _, message := range messages {
+		if err := consumer.AckTaskMessage(message); err != nil {
+			t.Fatalf("failed to acknowledge message: %v", err)
+		}
+	}
+	consumer.Close()
+
+	consumer = newBroker()
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if message, err := consumer.GetTaskMessageWithContext(ctx); err == nil {
+		t.Errorf("expected acknowledged messages not to be redelivered but received %s", message.ID)
+	}
+}
+
+// TestBrokerKafkaRebalance tests that offsets fetched before partition
+// was revoked and assigned back do not stall commits
+func TestBrokerKafkaRebalance(t *testing.T) {
+	broker := NewKafkaBroker([]string{"localhost:9092"})
+	for offset := int64(0); offset < 3; offset++ {
+		broker.fetched(kafka.Message{Partition: 1, Offset: offset})
+	}
+	if err := broker.commit(context.Background(), kafka.Message{Partition: 1, Offset: 0}); err != nil {
+		t.Fatalf("failed to commit message: %v", err)
+	}
+
+	// partition is consumed again from committed offset after rebalance
+	broker.fetched(kafka.Message{Partition: 1, Offset: 1})
+	broker.fetched(kafka.Message{Partition: 1, Offset: 2})
+	for _, offset := range []int64{2, 1} {
+		if err := broker.commit(context.Background(), kafka.Message{Partition: 1, Offset: offset}); err != nil {
+			t.Fatalf("failed to commit message: %v", err)
+		}
+	}
+	offsets := broker.offsets[1]
+	if len(offsets.fetched) != 0 || len(offsets.done) != 0 {
+		t.Errorf("expected all offsets to be committed but %v are fetched and %v are done", offsets.fetched, offsets.done)
+	}
+}
+
+// TestBrokerKafkaEncryption tests that serializers set up by client decode task messages of broker
+func TestBrokerKafkaEncryption(t *testing.T) {
+	broker := NewKafkaBroker([]string{"localhost:9092"})
+	keys := gocelery.NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	serializer, err := gocelery.GetSerializer("json")
+	if err != nil {
+		t.Fatalf("failed to get json serializer: %v", err)
+	}
+	taskMessage := newTaskMessage(1, 2)
+	celeryMessage, err := newCeleryMessage(taskMessage)
+	if err != nil {
+		t.Fatalf("failed to encode task message: %v", err)
+	}
+	celeryMessage.ContentType = gocelery.EncryptedContentType
+	celeryMessage.Body, err = taskMessage.EncodeWithSerializer(gocelery.NewEncryptedSerializer(serializer, keys))
+	if err != nil {
+		t.Fatalf("failed to encrypt task message: %v", err)
+	}
+	if message := broker.DecodeTaskMessage(celeryMessage); message != nil {
+		t.Errorf("expected encrypted task message not to be decoded without keys")
+	}
+
+	client, err := gocelery.NewCeleryClient(broker, gocelery.NewMemoryBackend(), 1)
+	if err != nil {
+		t.Fatalf("failed to create celery client: %v", err)
+	}
+	if err := client.SetEncryption(keys); err != nil {
+		t.Fatalf("failed to set up encryption: %v", err)
+	}
+	if message := broker.DecodeTaskMessage(celeryMessage); message == nil || message.ID != taskMessage.ID {
+		t.Errorf("expected task message %s to be decrypted but received %+v", taskMessage.ID, message)
+	}
+}
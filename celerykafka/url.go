@@ -0,0 +1,28 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerykafka
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gocelery/gocelery"
+)
+
+func init() {
+	for _, scheme := range []string{"kafka", "confluentkafka"} {
+		gocelery.RegisterBrokerURLScheme(scheme, newBrokerFromURL)
+	}
+}
+
+// newBrokerFromURL creates KafkaBroker from kafka://host1:9092,host2:9092 url
+func newBrokerFromURL(u *url.URL, query url.Values, queueName string) (gocelery.CeleryBroker, error) {
+	broker := NewKafkaBroker(strings.Split(u.Host, ","))
+	broker.QueueName = queueName
+	if groupID := query.Get("group_id"); groupID != "" {
+		broker.GroupID = groupID
+	}
+	return broker, nil
+}
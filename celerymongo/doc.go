@@ -0,0 +1,14 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+/*
+Package celerymongo provides gocelery result backend for mongodb compatible with celery mongodb backend.
+
+Importing it registers mongodb:// and mongodb+srv:// urls of gocelery.NewBackendFromURL.
+
+	import _ "github.com/gocelery/gocelery/celerymongo"
+
+	backend, err := gocelery.NewBackendFromURL("mongodb://localhost:27017/celery")
+*/
+package celerymongo
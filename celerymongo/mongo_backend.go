@@ -0,0 +1,257 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerymongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCeleryBackend is celery backend for mongodb.
+// Results are stored in celery_taskmeta and celery_groupmeta collections
+// using the document layout of celery mongodb result backend,
+// so that results can be shared with python celery.
+type MongoCeleryBackend struct {
+	Database        *mongo.Database
+	TaskCollection  string
+	GroupCollection string
+	// Expires is age of results removed by mongodb TTL index (0 keeps results forever)
+	Expires time.Duration
+	// Timeout limits duration of single mongodb operation
+	Timeout time.Duration
+}
+
+// mongoResult is result document of celery mongodb backend
+type mongoResult struct {
+	ID        string        `bson:"_id"`
+	Status    string        `bson:"status"`
+	Result    bson.RawValue `bson:"result"`
+	DateDone  time.Time     `bson:"date_done"`
+	Traceback bson.RawValue `bson:"traceback"`
+	Children  bson.RawValue `bson:"children"`
+}
+
+// mongoGroup is group result document of celery mongodb backend
+type mongoGroup struct {
+	ID       string    `bson:"_id"`
+	Result   string    `bson:"result"`
+	DateDone time.Time `bson:"date_done"`
+}
+
+// NewMongoBackend creates new MongoCeleryBackend storing results in given database
+func NewMongoBackend(database *mongo.Database) *MongoCeleryBackend {
+	return &MongoCeleryBackend{
+		Database:        database,
+		TaskCollection:  "celery_taskmeta",
+		GroupCollection: "celery_groupmeta",
+		Expires:         24 * time.Hour,
+		Timeout:         10 * time.Second,
+	}
+}
+
+// CreateIndexes creates TTL indexes on date_done of result collections
+// removing results older than Expires. Expiry of existing TTL indexes is updated.
+func (b *MongoCeleryBackend) CreateIndexes() error {
+	for _, collection := range []string{b.TaskCollection, b.GroupCollection} {
+		if err := b.createExpiryIndex(collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetResult retrieves result from mongodb
+func (b *MongoCeleryBackend) GetResult(taskID string) (*gocelery.ResultMessage, error) {
+	ctx, cancel := b.context()
+	defer cancel()
+	var doc mongoResult
+	err := b.Database.Collection(b.TaskCollection).FindOne(ctx, bson.M{"_id": taskID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, gocelery.ErrResultNotAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	resultMessage := &gocelery.ResultMessage{
+		ID:     doc.ID,
+		Status: doc.Status,
+	}
+	if !doc.DateDone.IsZero() {
+		resultMessage.DateDone = doc.DateDone.UTC().Format(gocelery.CeleryTimeLayout)
+	}
+	if resultMessage.Result, err = decodeMongoResult(doc.Result); err != nil {
+		return nil, err
+	}
+	if resultMessage.Traceback, err = decodeMongoValue(doc.Traceback); err != nil {
+		return nil, err
+	}
+	children, err := decodeMongoValue(doc.Children)
+	if err != nil {
+		return nil, err
+	}
+	if children != nil {
+		var ok bool
+		if resultMessage.Children, ok = children.([]interface{}); !ok {
+			return nil, fmt.Errorf("malformed children of task %s: %v", taskID, children)
+		}
+	}
+	return resultMessage, nil
+}
+
+// SetResult stores result in mongodb
+func (b *MongoCeleryBackend) SetResult(taskID string, result *gocelery.ResultMessage) error {
+	// celery json serializer stores result as encoded string
+	resBytes, err := json.Marshal(result.Result)
+	if err != nil {
+		return err
+	}
+	children := result.Children
+	if children == nil {
+		children = []interface{}{}
+	}
+	doc := bson.M{
+		"_id":       taskID,
+		"status":    result.Status,
+		"result":    string(resBytes),
+		"date_done": gocelery.ResultDateDone(result),
+		"traceback": result.Traceback,
+		"children":  children,
+	}
+	ctx, cancel := b.context()
+	defer cancel()
+	_, err = b.Database.Collection(b.TaskCollection).ReplaceOne(ctx, bson.M{"_id": taskID}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ForgetResult removes result from mongodb
+func (b *MongoCeleryBackend) ForgetResult(taskID string) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	_, err := b.Database.Collection(b.TaskCollection).DeleteOne(ctx, bson.M{"_id": taskID})
+	return err
+}
+
+// SaveGroup stores ids of tasks belonging to group
+func (b *MongoCeleryBackend) SaveGroup(groupID string, taskIDs []string) error {
+	if taskIDs == nil {
+		taskIDs = []string{}
+	}
+	resBytes, err := json.Marshal(taskIDs)
+	if err != nil {
+		return err
+	}
+	doc := mongoGroup{
+		ID:       groupID,
+		Result:   string(resBytes),
+		DateDone: time.Now().UTC(),
+	}
+	ctx, cancel := b.context()
+	defer cancel()
+	_, err = b.Database.Collection(b.GroupCollection).ReplaceOne(ctx, bson.M{"_id": groupID}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetGroup retrieves ids of tasks belonging to group
+func (b *MongoCeleryBackend) GetGroup(groupID string) ([]string, error) {
+	ctx, cancel := b.context()
+	defer cancel()
+	var doc mongoGroup
+	err := b.Database.Collection(b.GroupCollection).FindOne(ctx, bson.M{"_id": groupID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("group %s not available", groupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var taskIDs []string
+	if err := json.Unmarshal([]byte(doc.Result), &taskIDs); err != nil {
+		return nil, fmt.Errorf("malformed group result %s: %v", doc.Result, err)
+	}
+	return taskIDs, nil
+}
+
+// DeleteGroup removes group from mongodb
+func (b *MongoCeleryBackend) DeleteGroup(groupID string) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	_, err := b.Database.Collection(b.GroupCollection).DeleteOne(ctx, bson.M{"_id": groupID})
+	return err
+}
+
+// createExpiryIndex creates date_done index of collection or updates its expiry
+func (b *MongoCeleryBackend) createExpiryIndex(collection string) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	indexOptions := options.Index().SetName("date_done_1")
+	if b.Expires > 0 {
+		indexOptions.SetExpireAfterSeconds(int32(b.Expires / time.Second))
+	}
+	_, err := b.Database.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "date_done", Value: 1}},
+		Options: indexOptions,
+	})
+	var commandErr mongo.CommandError
+	if !errors.As(err, &commandErr) || commandErr.Name != "IndexOptionsConflict" || b.Expires <= 0 {
+		return err
+	}
+	// index exists with different expiry
+	return b.Database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "index", Value: bson.D{
+			{Key: "keyPattern", Value: bson.D{{Key: "date_done", Value: 1}}},
+			{Key: "expireAfterSeconds", Value: int32(b.Expires / time.Second)},
+		}},
+	}).Err()
+}
+
+func (b *MongoCeleryBackend) context() (context.Context, context.CancelFunc) {
+	if b.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), b.Timeout)
+}
+
+// decodeMongoResult decodes result field encoded by celery json serializer.
+// Results pickled by python celery are stored as binary.
+func decodeMongoResult(val bson.RawValue) (interface{}, error) {
+	if str, ok := val.StringValueOK(); ok {
+		var result interface{}
+		if err := json.Unmarshal([]byte(str), &result); err != nil {
+			return nil, fmt.Errorf("failed to decode result %q: %v", str, err)
+		}
+		return result, nil
+	}
+	if _, data, ok := val.BinaryOK(); ok {
+		return gocelery.PickleLoads(data)
+	}
+	// celery bson serializer stores result as it is
+	return decodeMongoValue(val)
+}
+
+// decodeMongoValue converts bson value into plain go value as decoded from json
+func decodeMongoValue(val bson.RawValue) (interface{}, error) {
+	if val.Type == 0 {
+		return nil, nil
+	}
+	extJSON, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: val}}, false, false)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		V interface{} `json:"v"`
+	}
+	if err := json.Unmarshal(extJSON, &doc); err != nil {
+		return nil, err
+	}
+	return doc.V, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerymongo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestBackendMongo tests results, groups and expiry indexes of mongodb backend against local mongod
+func TestBackendMongo(t *testing.T) {
+	backend, err := gocelery.NewBackendFromURL("mongodb://localhost:27017/" + uuid.Must(uuid.NewV4()).String())
+	if err != nil {
+		t.Fatalf("failed to create mongodb backend: %v", err)
+	}
+	mongoBackend := backend.(*MongoCeleryBackend)
+	defer mongoBackend.Database.Drop(context.Background())
+	// expiry of existing indexes is updated
+	mongoBackend.Expires = time.Hour
+	if err := mongoBackend.CreateIndexes(); err != nil {
+		t.Fatalf("failed to update expiry indexes: %v", err)
+	}
+	indexes, err := mongoBackend.Database.Collection(mongoBackend.TaskCollection).Indexes().ListSpecifications(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list indexes: %v", err)
+	}
+	expiry := int32(0)
+	for _, index := range indexes {
+		if index.Name == "date_done_1" && index.ExpireAfterSeconds != nil {
+			expiry = *index.ExpireAfterSeconds
+		}
+	}
+	if expiry != 3600 {
+		t.Errorf("expected expiry index of 3600 seconds but got %d", expiry)
+	}
+
+	taskID := uuid.Must(uuid.NewV4()).String()
+	if _, err := mongoBackend.GetResult(taskID); err == nil {
+		t.Errorf("expected error getting result of unknown task")
+	}
+	resultMessage := &gocelery.ResultMessage{
+		ID:       taskID,
+		Status:   "SUCCESS",
+		Result:   map[string]interface{}{"sum": float64(3)},
+		Children: []interface{}{},
+		DateDone: time.Now().UTC().Truncate(time.Millisecond).Format(gocelery.CeleryTimeLayout),
+	}
+	if err := mongoBackend.SetResult(taskID, resultMessage); err != nil {
+		t.Fatalf("error setting result to backend: %v", err)
+	}
+	// result is stored as json string as by celery json serializer
+	var doc bson.M
+	if err := mongoBackend.Database.Collection(mongoBackend.TaskCollection).FindOne(context.Background(), bson.M{"_id": taskID}).Decode(&doc); err != nil {
+		t.Fatalf("failed to find result document: %v", err)
+	}
+	if doc["result"] != `{"sum":3}` || doc["status"] != "SUCCESS" {
+		t.Errorf("unexpected result document %v", doc)
+	}
+	if _, ok := doc["date_done"].(primitive.DateTime); !ok {
+		t.Errorf("expected date_done to be stored as date but got %v", doc["date_done"])
+	}
+	res, err := mongoBackend.GetResult(taskID)
+	if err != nil {
+		t.Fatalf("error getting result from backend: %v", err)
+	}
+	if !reflect.DeepEqual(res, resultMessage) {
+		t.Errorf("result message received %v is different from original %v", res, resultMessage)
+	}
+
+	groupID := uuid.Must(uuid.NewV4()).String()
+	taskIDs := []string{taskID, uuid.Must(uuid.NewV4()).String()}
+	if err := mongoBackend.SaveGroup(groupID, taskIDs); err != nil {
+		t.Fatalf("failed to save group: %v", err)
+	}
+	groupTaskIDs, err := mongoBackend.GetGroup(groupID)
+	if err != nil {
+		t.Fatalf("failed to get group: %v", err)
+	}
+	if !reflect.DeepEqual(groupTaskIDs, taskIDs) {
+		t.Errorf("group task ids %v are different from original %v", groupTaskIDs, taskIDs)
+	}
+	if err := mongoBackend.DeleteGroup(groupID); err != nil {
+		t.Fatalf("failed to delete group: %v", err)
+	}
+	if _, err := mongoBackend.GetGroup(groupID); err == nil {
+		t.Errorf("expected error getting deleted group")
+	}
+}
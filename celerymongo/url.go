@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerymongo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	for _, scheme := range []string{"mongodb", "mongodb+srv"} {
+		gocelery.RegisterBackendURLScheme(scheme, newBackendFromURL)
+	}
+}
+
+// newBackendFromURL connects to mongodb given by url and creates result expiry indexes.
+// Results are stored in database given by url path, celery by default.
+func newBackendFromURL(uri string, u *url.URL, query url.Values) (gocelery.CeleryBackend, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", gocelery.RedactURL(u), err)
+	}
+	database := strings.TrimPrefix(u.Path, "/")
+	if database == "" {
+		database = "celery"
+	}
+	backend := NewMongoBackend(client.Database(database))
+	if err := backend.CreateIndexes(); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	return backend, nil
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+/*
+Package celerynats provides gocelery broker and result backend for nats jetstream.
+
+Importing it registers nats:// and tls:// urls of gocelery.NewBrokerFromURL and gocelery.NewBackendFromURL.
+
+	import _ "github.com/gocelery/gocelery/celerynats"
+
+	broker, err := gocelery.NewBrokerFromURL("nats://localhost:4222?queue=celery")
+*/
+package celerynats
@@ -0,0 +1,111 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerynats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSKVBackend is celery backend for nats storing results in jetstream key-value bucket
+type NATSKVBackend struct {
+	Conn      *nats.Conn
+	JetStream nats.JetStreamContext
+	Bucket    string
+	// TTL is age of results removed by bucket (0 keeps results forever).
+	// It is applied only when bucket is created.
+	TTL time.Duration
+
+	kvLock sync.Mutex
+	kv     nats.KeyValue
+}
+
+// NewNATSKVBackend creates new NATSKVBackend with given nats connection
+func NewNATSKVBackend(conn *nats.Conn) (*NATSKVBackend, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &NATSKVBackend{
+		Conn:      conn,
+		JetStream: js,
+		Bucket:    "celery_results",
+		TTL:       24 * time.Hour,
+	}, nil
+}
+
+// GetResult retrieves result from key-value bucket
+func (b *NATSKVBackend) GetResult(taskID string) (*gocelery.ResultMessage, error) {
+	kv, err := b.keyValue()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := kv.Get(b.resultKey(taskID))
+	if err == nats.ErrKeyNotFound {
+		return nil, gocelery.ErrResultNotAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resultMessage gocelery.ResultMessage
+	if err := json.Unmarshal(entry.Value(), &resultMessage); err != nil {
+		return nil, err
+	}
+	return &resultMessage, nil
+}
+
+// SetResult stores result in key-value bucket
+func (b *NATSKVBackend) SetResult(taskID string, result *gocelery.ResultMessage) error {
+	resBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	kv, err := b.keyValue()
+	if err != nil {
+		return err
+	}
+	_, err = kv.Put(b.resultKey(taskID), resBytes)
+	return err
+}
+
+// ForgetResult removes result from key-value bucket
+func (b *NATSKVBackend) ForgetResult(taskID string) error {
+	kv, err := b.keyValue()
+	if err != nil {
+		return err
+	}
+	return kv.Delete(b.resultKey(taskID))
+}
+
+// keyValue binds to key-value bucket creating it if it does not exist
+func (b *NATSKVBackend) keyValue() (nats.KeyValue, error) {
+	b.kvLock.Lock()
+	defer b.kvLock.Unlock()
+	if b.kv != nil {
+		return b.kv, nil
+	}
+	kv, err := b.JetStream.KeyValue(b.Bucket)
+	if err == nats.ErrBucketNotFound {
+		kv, err = b.JetStream.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket: b.Bucket,
+			TTL:    b.TTL,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.kv = kv
+	return kv, nil
+}
+
+// resultKey returns key of task result
+func (b *NATSKVBackend) resultKey(taskID string) string {
+	return fmt.Sprintf("celery-task-meta-%s", taskID)
+}
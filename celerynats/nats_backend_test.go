@@ -0,0 +1,51 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerynats
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/gocelery/gocelery"
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestBackendNATSKV tests set/get result of nats key-value backend
+func TestBackendNATSKV(t *testing.T) {
+	conn, cleanup := runNATSServer(t)
+	defer cleanup()
+	backend, err := NewNATSKVBackend(conn)
+	if err != nil {
+		t.Fatalf("failed to create nats backend: %v", err)
+	}
+	taskID := uuid.Must(uuid.NewV4()).String()
+	if _, err := backend.GetResult(taskID); err == nil {
+		t.Errorf("expected error getting result of unknown task")
+	}
+	resultMessage := &gocelery.ResultMessage{
+		ID:     taskID,
+		Status: gocelery.StateSuccess,
+		Result: rand.Float64(),
+	}
+	if err := backend.SetResult(taskID, resultMessage); err != nil {
+		t.Fatalf("error setting result to backend: %v", err)
+	}
+	res, err := backend.GetResult(taskID)
+	if err != nil {
+		t.Fatalf("error getting result from backend: %v", err)
+	}
+	if !reflect.DeepEqual(res, resultMessage) {
+		t.Errorf("result message received %v is different from original %v", res, resultMessage)
+	}
+	// bucket created by other backend is reused
+	other, err := NewNATSKVBackend(conn)
+	if err != nil {
+		t.Fatalf("failed to create nats backend: %v", err)
+	}
+	if _, err := other.GetResult(taskID); err != nil {
+		t.Errorf("error getting result from other backend: %v", err)
+	}
+}
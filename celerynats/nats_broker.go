@@ -0,0 +1,213 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerynats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSBroker is celery broker for nats based on jetstream.
+// Celery queues are mapped to subjects <SubjectPrefix>.<queue> of work queue stream
+// and consumed through durable pull consumer shared by all workers of the queue.
+// Messages are acknowledged only after task is executed and are redelivered
+// when they are not acknowledged within AckWait.
+// It is not compatible with python celery and is meant for go-only deployments.
+type NATSBroker struct {
+	Conn          *nats.Conn
+	JetStream     nats.JetStreamContext
+	StreamName    string
+	SubjectPrefix string
+	QueueName     string
+	// AckWait is time after which unacknowledged messages are redelivered
+	AckWait time.Duration
+	// FetchTimeout is time GetTaskMessage waits for message to arrive
+	FetchTimeout time.Duration
+
+	subLock      sync.Mutex
+	streamExists bool
+	sub          *nats.Subscription
+	messages     sync.Map
+	gocelery.BrokerSerializers
+}
+
+// NewNATSBroker creates new NATSBroker with given nats connection
+func NewNATSBroker(conn *nats.Conn) (*NATSBroker, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &NATSBroker{
+		Conn:          conn,
+		JetStream:     js,
+		StreamName:    "CELERY",
+		SubjectPrefix: "celery",
+		QueueName:     "celery",
+		AckWait:       time.Hour,
+		FetchTimeout:  100 * time.Millisecond,
+	}, nil
+}
+
+// SendCeleryMessage publishes CeleryMessage to jetstream subject of queue
+func (b *NATSBroker) SendCeleryMessage(message *gocelery.CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	b.subLock.Lock()
+	err = b.createStream()
+	b.subLock.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = b.JetStream.Publish(b.subject(), jsonBytes)
+	return err
+}
+
+// GetTaskMessage retrieves task message from jetstream waiting at most FetchTimeout
+func (b *NATSBroker) GetTaskMessage() (*gocelery.TaskMessage, error) {
+	sub, err := b.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := sub.Fetch(1, nats.MaxWait(b.FetchTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return b.decodeMessage(msgs[0])
+}
+
+// GetTaskMessageWithContext waits for task message to arrive until context is done
+func (b *NATSBroker) GetTaskMessageWithContext(ctx context.Context) (*gocelery.TaskMessage, error) {
+	sub, err := b.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		// fetch requests expire on server, so long waits are split into shorter requests
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := sub.Fetch(1, nats.Context(fetchCtx))
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return b.decodeMessage(msgs[0])
+	}
+}
+
+// AckTaskMessage acknowledges jetstream message of executed task
+func (b *NATSBroker) AckTaskMessage(message *gocelery.TaskMessage) error {
+	msg, ok := b.messages.Load(message.ID)
+	if !ok {
+		return fmt.Errorf("no pending jetstream message for task %s", message.ID)
+	}
+	if err := msg.(*nats.Msg).AckSync(); err != nil {
+		return err
+	}
+	b.messages.Delete(message.ID)
+	return nil
+}
+
+// decodeMessage decodes task message from jetstream message
+func (b *NATSBroker) decodeMessage(msg *nats.Msg) (*gocelery.TaskMessage, error) {
+	var message gocelery.CeleryMessage
+	err := json.Unmarshal(msg.Data, &message)
+	var taskMessage *gocelery.TaskMessage
+	if err == nil {
+		if taskMessage = b.DecodeTaskMessage(&message); taskMessage == nil {
+			err = fmt.Errorf("failed to decode task message of subject %s", msg.Subject)
+		}
+	}
+	if err != nil {
+		// malformed messages can never be processed
+		if termErr := msg.Term(); termErr != nil {
+			return nil, termErr
+		}
+		return nil, err
+	}
+	b.messages.Store(taskMessage.ID, msg)
+	return taskMessage, nil
+}
+
+// subscribe creates stream and durable pull consumer of queue if they do not exist
+func (b *NATSBroker) subscribe() (*nats.Subscription, error) {
+	b.subLock.Lock()
+	defer b.subLock.Unlock()
+	if b.sub != nil {
+		return b.sub, nil
+	}
+	if err := b.createStream(); err != nil {
+		return nil, err
+	}
+	sub, err := b.JetStream.PullSubscribe(
+		b.subject(),
+		b.durableName(),
+		nats.BindStream(b.StreamName),
+		nats.AckWait(b.AckWait),
+		nats.ManualAck(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.sub = sub
+	return sub, nil
+}
+
+// createStream creates work queue stream for subjects with SubjectPrefix.
+// It must be called with subLock held.
+func (b *NATSBroker) createStream() error {
+	if b.streamExists {
+		return nil
+	}
+	_, err := b.JetStream.StreamInfo(b.StreamName)
+	if err == nats.ErrStreamNotFound {
+		_, err = b.JetStream.AddStream(&nats.StreamConfig{
+			Name:      b.StreamName,
+			Subjects:  []string{b.SubjectPrefix + ".>"},
+			Retention: nats.WorkQueuePolicy,
+			Storage:   nats.FileStorage,
+		})
+		// stream may have been created concurrently
+		if err == nats.ErrStreamNameAlreadyInUse {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	b.streamExists = true
+	return nil
+}
+
+// subject returns jetstream subject of queue
+func (b *NATSBroker) subject() string {
+	return b.SubjectPrefix + "." + b.QueueName
+}
+
+// durableName returns name of durable consumer of queue.
+// Consumer names cannot contain dots, wildcards and whitespace.
+func (b *NATSBroker) durableName() string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, b.QueueName)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerynats
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocelery/gocelery"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// newCeleryMessage creates celery message of task message encoded as by python celery
+func newCeleryMessage(taskMessage *gocelery.TaskMessage) (*gocelery.CeleryMessage, error) {
+	encodedTaskMessage, err := taskMessage.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &gocelery.CeleryMessage{
+		Body:            encodedTaskMessage,
+		ContentType:     "application/json",
+		ContentEncoding: "utf-8",
+		Properties: gocelery.CeleryProperties{
+			BodyEncoding: "base64",
+			DeliveryInfo: gocelery.CeleryDeliveryInfo{
+				RoutingKey: "celery",
+				Exchange:   "celery",
+			},
+			DeliveryMode: 2,
+			DeliveryTag:  uuid.Must(uuid.NewV4()).String(),
+		},
+	}, nil
+}
+
+// newTaskMessage creates task message of add task with given arguments
+func newTaskMessage(args ...interface{}) *gocelery.TaskMessage {
+	return &gocelery.TaskMessage{
+		ID:     uuid.Must(uuid.NewV4()).String(),
+		Task:   "add",
+		Args:   args,
+		Kwargs: map[string]interface{}{},
+	}
+}
+
+func add(a int, b int) int {
+	return a + b
+}
+
+// runNATSServer starts embedded nats server with jetstream enabled and connects to it
+func runNATSServer(t *testing.T) (*nats.Conn, func()) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	server := natsserver.RunServer(&opts)
+	conn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect to nats server: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+// TestBrokerNATS tests acknowledgement, redelivery and blocking receive of nats broker
+func TestBrokerNATS(t *testing.T) {
+	conn, cleanup := runNATSServer(t)
+	defer cleanup()
+	broker, err := NewNATSBroker(conn)
+	if err != nil {
+		t.Fatalf("failed to create nats broker: %v", err)
+	}
+	broker.AckWait = 100 * time.Millisecond
+	if _, err := broker.GetTaskMessage(); err == nil {
+		t.Errorf("expected error getting message from empty queue")
+	}
+
+	celeryMessage, err := newCeleryMessage(newTaskMessage(rand.Intn(10), rand.Intn(10)))
+	if err != nil || celeryMessage == nil {
+		t.Fatalf("failed to construct celery message: %v", err)
+	}
+	if err := broker.SendCeleryMessage(celeryMessage); err != nil {
+		t.Fatalf("failed to send celery message to broker: %v", err)
+	}
+	message, err := broker.GetTaskMessage()
+	if err != nil {
+		t.Fatalf("failed to get celery message from broker: %v", err)
+	}
+	originalMessage := celeryMessage.GetTaskMessage()
+	if !reflect.DeepEqual(message, originalMessage) {
+		t.Errorf("received message %v different from original message %v", message, originalMessage)
+	}
+
+	// message is not acknowledged within AckWait
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	redelivered, err := broker.GetTaskMessageWithContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive redelivered message: %v", err)
+	}
+	if !reflect.DeepEqual(redelivered, originalMessage) {
+		t.Errorf("redelivered message %v different from original message %v", redelivered, originalMessage)
+	}
+	if err := broker.AckTaskMessage(redelivered); err != nil {
+		t.Fatalf("failed to acknowledge message: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := broker.GetTaskMessageWithContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected acknowledged message not to be redelivered but got %v", err)
+	}
+}
+
+// TestBrokerNATSWorker tests that worker receives task messages from blocking broker
+func TestBrokerNATSWorker(t *testing.T) {
+	conn, cleanup := runNATSServer(t)
+	defer cleanup()
+	broker, err := NewNATSBroker(conn)
+	if err != nil {
+		t.Fatalf("failed to create nats broker: %v", err)
+	}
+	backend, err := NewNATSKVBackend(conn)
+	if err != nil {
+		t.Fatalf("failed to create nats backend: %v", err)
+	}
+	celeryClient, err := gocelery.NewCeleryClient(broker, backend, 2)
+	if err != nil {
+		t.Fatalf("failed to create celery client: %v", err)
+	}
+	taskName := uuid.Must(uuid.NewV4()).String()
+	celeryClient.Register(taskName, add)
+	celeryClient.StartWorker()
+	asyncResult, err := celeryClient.Delay(taskName, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	res, err := asyncResult.Get(2 * time.Second)
+	if err != nil {
+		t.Errorf("failed to get result: %v", err)
+	} else if res.(float64) != 3 {
+		t.Errorf("expected result 3 but received %v", res)
+	}
+	celeryClient.StopWorker()
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerynats
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gocelery/gocelery"
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	for _, scheme := range []string{"nats", "tls"} {
+		gocelery.RegisterBrokerURLScheme(scheme, newBrokerFromURL)
+		gocelery.RegisterBackendURLScheme(scheme, newBackendFromURL)
+	}
+}
+
+// newBrokerFromURL creates NATSBroker connected to nats server given by url
+func newBrokerFromURL(u *url.URL, query url.Values, queueName string) (gocelery.CeleryBroker, error) {
+	conn, err := newConnectionFromURL(u, query)
+	if err != nil {
+		return nil, err
+	}
+	broker, err := NewNATSBroker(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	broker.QueueName = queueName
+	return broker, nil
+}
+
+// newBackendFromURL creates NATSKVBackend connected to nats server given by url
+func newBackendFromURL(uri string, u *url.URL, query url.Values) (gocelery.CeleryBackend, error) {
+	conn, err := newConnectionFromURL(u, query)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := NewNATSKVBackend(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// newConnectionFromURL connects to nats server given by url
+func newConnectionFromURL(u *url.URL, query url.Values) (*nats.Conn, error) {
+	var options []nats.Option
+	if timeout, err := gocelery.ParseURLDuration(query, "connect_timeout"); err != nil {
+		return nil, err
+	} else if timeout > 0 {
+		options = append(options, nats.Timeout(timeout))
+	}
+	tlsConfig, err := gocelery.TLSConfigFromURL(query)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+	serverURL := *u
+	serverURL.RawQuery = ""
+	conn, err := nats.Connect(serverURL.String(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", gocelery.RedactURL(u), err)
+	}
+	return conn, nil
+}
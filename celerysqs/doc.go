@@ -0,0 +1,19 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+/*
+Package celerysqs provides gocelery broker for amazon sqs compatible with kombu sqs transport.
+
+Importing it registers kombu-style sqs://aws_access_key_id:aws_secret_access_key@ urls
+of gocelery.NewBrokerFromURL with additional query options
+
+	region              aws region of sqs queues
+	endpoint_url        url of sqs compatible endpoint such as http://localhost:9324
+	queue_name_prefix   prefix of sqs queue names
+	visibility_timeout  seconds after which unacknowledged sqs messages are redelivered
+	wait_time_seconds   sqs long polling time in seconds
+
+	import _ "github.com/gocelery/gocelery/celerysqs"
+*/
+package celerysqs
@@ -0,0 +1,257 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerysqs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gocelery/gocelery"
+	uuid "github.com/satori/go.uuid"
+)
+
+// SQSBroker is celery broker for amazon sqs compatible with kombu sqs transport.
+// Messages are base64 encoded and stay invisible to other workers for VisibilityTimeout
+// after they are received, so that messages of crashed workers are delivered again.
+// Messages are deleted from queue only after task is executed.
+// Queue names ending with .fifo are created as fifo queues.
+type SQSBroker struct {
+	Client          *sqs.Client
+	QueueName       string
+	QueueNamePrefix string
+	// VisibilityTimeout is time after which received messages not yet deleted are redelivered.
+	// It is applied only when queue is created.
+	VisibilityTimeout time.Duration
+	// WaitTime is time single long polling request waits for message to arrive (at most 20 seconds)
+	WaitTime time.Duration
+	// MessageGroupID returns message group of task sent to fifo queue.
+	// Messages of the same group are delivered in order, all messages share group "default" by default.
+	MessageGroupID func(*gocelery.TaskMessage) string
+
+	queueLock sync.Mutex
+	queueURLs map[string]string
+	receipts  sync.Map
+	gocelery.BrokerSerializers
+}
+
+// NewSQSBroker creates new SQSBroker with given sqs client
+func NewSQSBroker(client *sqs.Client) *SQSBroker {
+	return &SQSBroker{
+		Client:    client,
+		QueueName: "celery",
+		// kombu default visibility timeout
+		VisibilityTimeout: 30 * time.Minute,
+		WaitTime:          10 * time.Second,
+		queueURLs:         map[string]string{},
+	}
+}
+
+// SendCeleryMessage sends base64 encoded CeleryMessage to sqs queue
+func (b *SQSBroker) SendCeleryMessage(message *gocelery.CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	queueURL, err := b.getQueueURL(context.Background())
+	if err != nil {
+		return err
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(base64.StdEncoding.EncodeToString(jsonBytes)),
+	}
+	if b.isFIFO() {
+		groupID := "default"
+		if b.MessageGroupID != nil {
+			err := b.InspectTaskMessage(message, func(taskMessage *gocelery.TaskMessage) {
+				if id := b.MessageGroupID(taskMessage); id != "" {
+					groupID = id
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("message group: %v", err)
+			}
+		}
+		input.MessageGroupId = aws.String(groupID)
+		input.MessageDeduplicationId = aws.String(uuid.Must(uuid.NewV4()).String())
+	}
+	_, err = b.Client.SendMessage(context.Background(), input)
+	return err
+}
+
+// GetTaskMessage retrieves task message from sqs queue without waiting
+func (b *SQSBroker) GetTaskMessage() (*gocelery.TaskMessage, error) {
+	ctx := context.Background()
+	msg, err := b.receiveMessage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("sqs queue %s is empty", b.QueueName)
+	}
+	return b.decodeMessage(ctx, msg)
+}
+
+// GetTaskMessageWithContext long polls sqs queue until task message arrives or context is done
+func (b *SQSBroker) GetTaskMessageWithContext(ctx context.Context) (*gocelery.TaskMessage, error) {
+	for {
+		msg, err := b.receiveMessage(ctx, b.WaitTime)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			return b.decodeMessage(ctx, msg)
+		}
+	}
+}
+
+// AckTaskMessage deletes sqs message of executed task
+func (b *SQSBroker) AckTaskMessage(message *gocelery.TaskMessage) error {
+	receipt, ok := b.receipts.Load(message.ID)
+	if !ok {
+		return fmt.Errorf("no pending sqs message for task %s", message.ID)
+	}
+	if err := b.deleteMessage(context.Background(), receipt.(string)); err != nil {
+		return err
+	}
+	b.receipts.Delete(message.ID)
+	return nil
+}
+
+// receiveMessage receives single message from queue waiting at most waitTime.
+// It returns nil message when queue is empty.
+func (b *SQSBroker) receiveMessage(ctx context.Context, waitTime time.Duration) (*types.Message, error) {
+	queueURL, err := b.getQueueURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	output, err := b.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: 1,
+		WaitTimeSeconds:     int32(waitTime / time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Messages) == 0 {
+		return nil, nil
+	}
+	return &output.Messages[0], nil
+}
+
+// decodeMessage decodes task message from base64 encoded or plain json body of sqs message
+func (b *SQSBroker) decodeMessage(ctx context.Context, msg *types.Message) (*gocelery.TaskMessage, error) {
+	body := []byte(aws.ToString(msg.Body))
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		decoded, err := base64.StdEncoding.DecodeString(string(body))
+		if err == nil {
+			body = decoded
+		}
+	}
+	var message gocelery.CeleryMessage
+	err := json.Unmarshal(body, &message)
+	var taskMessage *gocelery.TaskMessage
+	if err == nil {
+		if taskMessage = b.DecodeTaskMessage(&message); taskMessage == nil {
+			err = fmt.Errorf("failed to decode task message of sqs message %s", aws.ToString(msg.MessageId))
+		}
+	}
+	if err != nil {
+		// malformed messages can never be processed
+		if deleteErr := b.deleteMessage(ctx, aws.ToString(msg.ReceiptHandle)); deleteErr != nil {
+			return nil, deleteErr
+		}
+		return nil, err
+	}
+	b.receipts.Store(taskMessage.ID, aws.ToString(msg.ReceiptHandle))
+	return taskMessage, nil
+}
+
+// deleteMessage deletes message with given receipt handle from queue
+func (b *SQSBroker) deleteMessage(ctx context.Context, receiptHandle string) error {
+	queueURL, err := b.getQueueURL(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = b.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	return err
+}
+
+// getQueueURL returns url of queue creating queue if it does not exist
+func (b *SQSBroker) getQueueURL(ctx context.Context) (string, error) {
+	name := b.sqsQueueName()
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+	if queueURL, ok := b.queueURLs[name]; ok {
+		return queueURL, nil
+	}
+	output, err := b.Client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	var notFound *types.QueueDoesNotExist
+	if errors.As(err, &notFound) {
+		attributes := map[string]string{
+			string(types.QueueAttributeNameVisibilityTimeout): strconv.Itoa(int(b.VisibilityTimeout / time.Second)),
+		}
+		if b.isFIFO() {
+			attributes[string(types.QueueAttributeNameFifoQueue)] = "true"
+		}
+		var created *sqs.CreateQueueOutput
+		created, err = b.Client.CreateQueue(ctx, &sqs.CreateQueueInput{
+			QueueName:  aws.String(name),
+			Attributes: attributes,
+		})
+		if err == nil {
+			b.queueURLs[name] = aws.ToString(created.QueueUrl)
+			return b.queueURLs[name], nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get url of sqs queue %s: %v", name, err)
+	}
+	b.queueURLs[name] = aws.ToString(output.QueueUrl)
+	return b.queueURLs[name], nil
+}
+
+// isFIFO reports whether queue is fifo queue
+func (b *SQSBroker) isFIFO() bool {
+	return strings.HasSuffix(b.QueueName, ".fifo")
+}
+
+// sqsQueueName returns name of sqs queue the same way as kombu.
+// Punctuation other than hyphen and underscore is replaced by underscore
+// and dots are replaced by hyphens while .fifo suffix is kept.
+func (b *SQSBroker) sqsQueueName() string {
+	name := b.QueueNamePrefix + b.QueueName
+	suffix := ""
+	if b.isFIFO() {
+		name, suffix = strings.TrimSuffix(name, ".fifo"), ".fifo"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '.':
+			return '-'
+		case r == '-' || r == '_':
+			return r
+		case r < 128 && strings.ContainsRune("!\"#$%&'()*+,/:;<=>?@[\\]^`{|}~", r):
+			return '_'
+		}
+		return r
+	}, name) + suffix
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerysqs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gocelery/gocelery"
+	uuid "github.com/satori/go.uuid"
+)
+
+// newCeleryMessage creates celery message of task message encoded as by python celery
+func newCeleryMessage(taskMessage *gocelery.TaskMessage) (*gocelery.CeleryMessage, error) {
+	encodedTaskMessage, err := taskMessage.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &gocelery.CeleryMessage{
+		Body:            encodedTaskMessage,
+		ContentType:     "application/json",
+		ContentEncoding: "utf-8",
+		Properties: gocelery.CeleryProperties{
+			BodyEncoding: "base64",
+			DeliveryInfo: gocelery.CeleryDeliveryInfo{
+				RoutingKey: "celery",
+				Exchange:   "celery",
+			},
+			DeliveryMode: 2,
+			DeliveryTag:  uuid.Must(uuid.NewV4()).String(),
+		},
+	}, nil
+}
+
+// newTaskMessage creates task message of add task with given arguments
+func newTaskMessage(args ...interface{}) *gocelery.TaskMessage {
+	return &gocelery.TaskMessage{
+		ID:     uuid.Must(uuid.NewV4()).String(),
+		Task:   "add",
+		Args:   args,
+		Kwargs: map[string]interface{}{},
+	}
+}
+
+// TestBrokerSQS tests kombu message format and redelivery of sqs broker
+// against local sqs compatible endpoint such as elasticmq
+func TestBrokerSQS(t *testing.T) {
+	broker, err := gocelery.NewBrokerFromURL("sqs://key:secret@?region=us-east-1&endpoint_url=http://localhost:9324&visibility_timeout=1&wait_time_seconds=1")
+	if err != nil {
+		t.Fatalf("failed to create sqs broker: %v", err)
+	}
+	sqsBroker := broker.(*SQSBroker)
+	sqsBroker.QueueName = "gocelery." + uuid.Must(uuid.NewV4()).String() + ".fifo"
+	if name := sqsBroker.sqsQueueName(); !strings.HasPrefix(name, "gocelery-") || !strings.HasSuffix(name, ".fifo") {
+		t.Errorf("expected kombu queue name of %s but received %s", sqsBroker.QueueName, name)
+	}
+
+	// messages sent by kombu are base64 encoded json
+	taskMessage := newTaskMessage(1, 2)
+	taskID := taskMessage.ID
+	celeryMessage, err := newCeleryMessage(taskMessage)
+	if err != nil {
+		t.Fatalf("failed to encode task message: %v", err)
+	}
+	jsonBytes, err := json.Marshal(celeryMessage)
+	if err != nil {
+		t.Fatalf("failed to marshal celery message: %v", err)
+	}
+	queueURL, err := sqsBroker.getQueueURL(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create sqs queue: %v", err)
+	}
+	_, err = sqsBroker.Client.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:               aws.String(queueURL),
+		MessageBody:            aws.String(base64.StdEncoding.EncodeToString(jsonBytes)),
+		MessageGroupId:         aws.String("default"),
+		MessageDeduplicationId: aws.String(taskID),
+	})
+	if err != nil {
+		t.Fatalf("failed to send kombu message: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	message, err := sqsBroker.GetTaskMessageWithContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to get task message: %v", err)
+	}
+	if message.ID != taskID || !reflect.DeepEqual(message.Args, []interface{}{float64(1), float64(2)}) {
+		t.Errorf("received unexpected task message %+v", message)
+	}
+
+	// message is redelivered when it is not acknowledged within visibility timeout
+	if message, err := sqsBroker.GetTaskMessage(); err == nil {
+		t.Errorf("expected message to be invisible but received %s", message.ID)
+	}
+	message, err = sqsBroker.GetTaskMessageWithContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to get redelivered task message: %v", err)
+	}
+	if message.ID != taskID {
+		t.Errorf("expected task %s to be redelivered but received %s", taskID, message.ID)
+	}
+	if err := sqsBroker.AckTaskMessage(message); err != nil {
+		t.Fatalf("failed to acknowledge message: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if message, err := sqsBroker.GetTaskMessage(); err == nil {
+		t.Errorf("expected acknowledged message to be deleted but received %s", message.ID)
+	}
+}
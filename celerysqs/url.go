@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package celerysqs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gocelery/gocelery"
+)
+
+func init() {
+	gocelery.RegisterBrokerURLScheme("sqs", newBrokerFromURL)
+}
+
+// newBrokerFromURL creates SQSBroker from kombu-style sqs://aws_access_key_id:aws_secret_access_key@ url.
+// Credentials missing from url are loaded from environment and shared aws configuration.
+func newBrokerFromURL(u *url.URL, query url.Values, queueName string) (gocelery.CeleryBroker, error) {
+	var opts []func(*config.LoadOptions) error
+	if region := query.Get("region"); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if u.User != nil {
+		secret, _ := u.User.Password()
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(u.User.Username(), secret, ""),
+		))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws configuration for %s: %v", gocelery.RedactURL(u), err)
+	}
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint := query.Get("endpoint_url"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	broker := NewSQSBroker(client)
+	broker.QueueName = queueName
+	broker.QueueNamePrefix = query.Get("queue_name_prefix")
+	if timeout, err := gocelery.ParseURLDuration(query, "visibility_timeout"); err != nil {
+		return nil, err
+	} else if timeout > 0 {
+		broker.VisibilityTimeout = timeout
+	}
+	if value := query.Get("wait_time_seconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || seconds > 20 {
+			return nil, fmt.Errorf("invalid wait_time_seconds %q: must be between 0 and 20", value)
+		}
+		broker.WaitTime = time.Duration(seconds) * time.Second
+	}
+	return broker, nil
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+// Command gocelery-gen generates ParseKwargs method of CeleryTask structs
+// and typed Delay wrapper sending them with keyword arguments.
+//
+// It is meant to be run by go generate in package of task struct:
+//
+//	//go:generate go run github.com/gocelery/gocelery/cmd/gocelery-gen -type addTask -name worker.add
+//
+// Fields of task struct tagged with celery tag are keyword arguments of task.
+// Tag gives name of keyword argument followed by options required or default=value,
+// where default must be the last option:
+//
+//	type addTask struct {
+//		a int `celery:"a,required"`
+//		b int `celery:"b,default=1"`
+//	}
+//
+// Generated ParseKwargs refuses unexpected keyword arguments, missing required arguments
+// and arguments not convertible to field types. Missing optional arguments reset fields
+// to their default or zero values.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// gocelery is import path of gocelery package
+const gocelery = "github.com/gocelery/gocelery"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gocelery-gen: ")
+	typeName := flag.String("type", "", "name of task struct (required)")
+	taskName := flag.String("name", "", "name of celery task, defaults to name of task struct")
+	output := flag.String("output", "", "output file name, defaults to <type>_celery.go")
+	dir := flag.String("dir", ".", "directory of package containing task struct")
+	flag.Parse()
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	task, err := parseTask(*dir, *typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *taskName != "" {
+		task.TaskName = *taskName
+	}
+	src, err := generate(task)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outputName := *output
+	if outputName == "" {
+		outputName = strings.ToLower(*typeName) + "_celery.go"
+		if strings.HasSuffix(task.FileName, "_test.go") {
+			outputName = strings.ToLower(*typeName) + "_celery_test.go"
+		}
+		outputName = filepath.Join(*dir, outputName)
+	}
+	if err := ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// task is parsed task struct
+type task struct {
+	Package  string
+	FileName string
+	TypeName string
+	TaskName string
+	Fields   []*field
+}
+
+// field is keyword argument of task struct
+type field struct {
+	Name     string
+	Kwarg    string
+	Type     string
+	Required bool
+	Default  string
+
+	// Parser is gocelery function converting arguments of basic types,
+	// other types are converted by gocelery.ConvertArgument
+	Parser  string
+	BitSize int
+	Zero    string
+}
+
+// basicTypes maps basic field types to argument parser, bit size and zero value
+var basicTypes = map[string]struct {
+	parser  string
+	bitSize int
+	zero    string
+}{
+	"string":  {"StringArgument", 0, `""`},
+	"bool":    {"BoolArgument", 0, "false"},
+	"int":     {"IntArgument", 0, "0"},
+	"int8":    {"IntArgument", 8, "0"},
+	"int16":   {"IntArgument", 16, "0"},
+	"int32":   {"IntArgument", 32, "0"},
+	"rune":    {"IntArgument", 32, "0"},
+	"int64":   {"IntArgument", 64, "0"},
+	"uint":    {"UintArgument", 0, "0"},
+	"uint8":   {"UintArgument", 8, "0"},
+	"byte":    {"UintArgument", 8, "0"},
+	"uint16":  {"UintArgument", 16, "0"},
+	"uint32":  {"UintArgument", 32, "0"},
+	"uint64":  {"UintArgument", 64, "0"},
+	"float32": {"FloatArgument", 32, "0"},
+	"float64": {"FloatArgument", 64, "0"},
+}
+
+// parseTask finds task struct of given name in package of dir
+func parseTask(dir, typeName string) (*task, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		for fileName, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if typeSpec.Name.Name != typeName {
+						continue
+					}
+					structType, ok := typeSpec.Type.(*ast.StructType)
+					if !ok {
+						return nil, fmt.Errorf("type %s is not struct", typeName)
+					}
+					fields, err := parseFields(fset, structType)
+					if err != nil {
+						return nil, fmt.Errorf("type %s: %v", typeName, err)
+					}
+					return &task{
+						Package:  file.Name.Name,
+						FileName: filepath.Base(fileName),
+						TypeName: typeName,
+						TaskName: typeName,
+						Fields:   fields,
+					}, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+}
+
+// parseFields parses struct fields tagged with celery tag
+func parseFields(fset *token.FileSet, structType *ast.StructType) ([]*field, error) {
+	var fields []*field
+	kwargs := map[string]bool{}
+	for _, astField := range structType.Fields.List {
+		if astField.Tag == nil {
+			continue
+		}
+		tagValue, err := strconv.Unquote(astField.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		tag, ok := reflect.StructTag(tagValue).Lookup("celery")
+		if !ok || tag == "-" {
+			continue
+		}
+		var typeName bytes.Buffer
+		if err := format.Node(&typeName, fset, astField.Type); err != nil {
+			return nil, err
+		}
+		for _, ident := range astField.Names {
+			f, err := parseField(ident.Name, typeName.String(), tag)
+			if err != nil {
+				return nil, err
+			}
+			if kwargs[f.Kwarg] {
+				return nil, fmt.Errorf("duplicate keyword argument %s", f.Kwarg)
+			}
+			kwargs[f.Kwarg] = true
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields tagged with celery tag")
+	}
+	return fields, nil
+}
+
+// parseField parses celery tag of field
+func parseField(name, typeName, tag string) (*field, error) {
+	f := &field{Name: name, Kwarg: name, Type: typeName}
+	if basic, ok := basicTypes[typeName]; ok {
+		f.Parser, f.BitSize, f.Zero = basic.parser, basic.bitSize, basic.zero
+	}
+	kwarg, options := tag, ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		kwarg, options = tag[:i], tag[i+1:]
+	}
+	if kwarg != "" {
+		f.Kwarg = kwarg
+	}
+	for options != "" {
+		if strings.HasPrefix(options, "default=") {
+			if err := f.setDefault(strings.TrimPrefix(options, "default=")); err != nil {
+				return nil, err
+			}
+			break
+		}
+		option := options
+		if i := strings.Index(options, ","); i >= 0 {
+			option, options = options[:i], options[i+1:]
+		} else {
+			options = ""
+		}
+		switch option {
+		case "required":
+			f.Required = true
+		default:
+			return nil, fmt.Errorf("unknown option %s of field %s", option, name)
+		}
+	}
+	if f.Required && f.Default != "" {
+		return nil, fmt.Errorf("required field %s has default value", name)
+	}
+	return f, nil
+}
+
+// setDefault validates default value of field and sets it as go literal
+func (f *field) setDefault(value string) error {
+	var err error
+	switch f.Parser {
+	case "StringArgument":
+		f.Default = strconv.Quote(value)
+	case "BoolArgument":
+		var b bool
+		b, err = strconv.ParseBool(value)
+		f.Default = strconv.FormatBool(b)
+	case "IntArgument":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, bitSize(f.BitSize))
+		f.Default = strconv.FormatInt(n, 10)
+	case "UintArgument":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, bitSize(f.BitSize))
+		f.Default = strconv.FormatUint(n, 10)
+	case "FloatArgument":
+		var n float64
+		n, err = strconv.ParseFloat(value, f.BitSize)
+		f.Default = strconv.FormatFloat(n, 'g', -1, f.BitSize)
+	default:
+		return fmt.Errorf("default value of field %s of type %s is not supported", f.Name, f.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid default value of field %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+// bitSize returns bit size of int and uint types for strconv
+func bitSize(n int) int {
+	if n == 0 {
+		return strconv.IntSize
+	}
+	return n
+}
+
+// generate generates go source of ParseKwargs, Kwargs and Delay methods of task
+func generate(t *task) ([]byte, error) {
+	qualifier := "gocelery."
+	if t.Package == "gocelery" {
+		qualifier = ""
+	}
+	usesReflect := false
+	for _, f := range t.Fields {
+		if f.Parser == "" {
+			usesReflect = true
+		}
+	}
+	var buf bytes.Buffer
+	err := sourceTemplate.Execute(&buf, map[string]interface{}{
+		"Task":        t,
+		"Qualifier":   qualifier,
+		"UsesReflect": usesReflect,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated source: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+var sourceTemplate = template.Must(template.New("source").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by gocelery-gen. DO NOT EDIT.
+
+package {{.Task.Package}}
+
+import (
+	"fmt"
+{{- if .UsesReflect}}
+	"reflect"
+{{- end}}
+{{- if .Qualifier}}
+
+	"` + gocelery + `"
+{{- end}}
+)
+
+{{$q := .Qualifier}}{{with .Task}}
+// ParseKwargs parses keyword arguments of {{.TaskName}} task
+func (t *{{.TypeName}}) ParseKwargs(kwargs map[string]interface{}) error {
+	for name := range kwargs {
+		switch name {
+		case {{range $i, $f := .Fields}}{{if $i}}, {{end}}{{quote $f.Kwarg}}{{end}}:
+		default:
+			return fmt.Errorf("unexpected kwarg %s", name)
+		}
+	}
+{{- range .Fields}}
+	if kwarg, ok := kwargs[{{quote .Kwarg}}]; ok {
+	{{- if .Parser}}
+		v, err := {{$q}}{{.Parser}}(kwarg{{if not (eq .Parser "StringArgument" "BoolArgument")}}, {{.BitSize}}{{end}})
+		if err != nil {
+			return fmt.Errorf("malformed kwarg {{.Kwarg}}: %v", err)
+		}
+		t.{{.Name}} = {{if eq .Type "string" "bool" "int64" "uint64" "float64"}}v{{else}}{{.Type}}(v){{end}}
+	{{- else}}
+		v, err := {{$q}}ConvertArgument(kwarg, reflect.TypeOf(&t.{{.Name}}).Elem())
+		if err != nil {
+			return fmt.Errorf("malformed kwarg {{.Kwarg}}: %v", err)
+		}
+		reflect.ValueOf(&t.{{.Name}}).Elem().Set(v)
+	{{- end}}
+	} else {
+	{{- if .Required}}
+		return fmt.Errorf("undefined kwarg {{.Kwarg}}")
+	{{- else if .Default}}
+		t.{{.Name}} = {{.Default}}
+	{{- else if .Zero}}
+		t.{{.Name}} = {{.Zero}}
+	{{- else}}
+		reflect.ValueOf(&t.{{.Name}}).Elem().Set(reflect.Zero(reflect.TypeOf(&t.{{.Name}}).Elem()))
+	{{- end}}
+	}
+{{- end}}
+	return nil
+}
+
+// Kwargs returns fields of task as keyword arguments of {{.TaskName}} task
+func (t *{{.TypeName}}) Kwargs() map[string]interface{} {
+	return map[string]interface{}{
+	{{- range .Fields}}
+		{{quote .Kwarg}}: t.{{.Name}},
+	{{- end}}
+	}
+}
+
+// Delay sends {{.TaskName}} task with keyword arguments of t using given client
+func (t *{{.TypeName}}) Delay(cc *{{$q}}CeleryClient) (*{{$q}}AsyncResult, error) {
+	return cc.DelayKwargs({{quote .TaskName}}, t.Kwargs())
+}
+{{end}}`))
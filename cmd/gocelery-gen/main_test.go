@@ -0,0 +1,89 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestGenerate tests generated source of task struct against golden file
+func TestGenerate(t *testing.T) {
+	task, err := parseTask("testdata", "orderTask")
+	if err != nil {
+		t.Fatalf("failed to parse task: %v", err)
+	}
+	task.TaskName = "shop.order"
+	src, err := generate(task)
+	if err != nil {
+		t.Fatalf("failed to generate source: %v", err)
+	}
+	golden, err := ioutil.ReadFile("testdata/ordertask_celery.go.golden")
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if string(src) != string(golden) {
+		t.Errorf("generated source differs from golden file:\n%s", src)
+	}
+
+	// generated code in gocelery package does not import it
+	task.Package = "gocelery"
+	src, err = generate(task)
+	if err != nil {
+		t.Fatalf("failed to generate source: %v", err)
+	}
+	if strings.Contains(string(src), "gocelery.") {
+		t.Errorf("expected unqualified gocelery identifiers in source:\n%s", src)
+	}
+}
+
+// TestParseField tests parsing of celery tags
+func TestParseField(t *testing.T) {
+	testCases := []struct {
+		name     string
+		typeName string
+		tag      string
+		expected field
+	}{
+		{name: "field name", typeName: "string", tag: "", expected: field{Kwarg: "f"}},
+		{name: "required", typeName: "int", tag: "n,required", expected: field{Kwarg: "n", Required: true}},
+		{name: "string default with comma", typeName: "string", tag: "s,default=a,b", expected: field{Kwarg: "s", Default: `"a,b"`}},
+		{name: "empty string default", typeName: "string", tag: "s,default=", expected: field{Kwarg: "s", Default: `""`}},
+		{name: "uint default", typeName: "uint8", tag: "u,default=255", expected: field{Kwarg: "u", Default: "255"}},
+		{name: "float default", typeName: "float64", tag: ",default=1.5", expected: field{Kwarg: "f", Default: "1.5"}},
+	}
+	for _, tc := range testCases {
+		f, err := parseField("f", tc.typeName, tc.tag)
+		if err != nil {
+			t.Errorf("test '%s': failed to parse field: %v", tc.name, err)
+			continue
+		}
+		if f.Kwarg != tc.expected.Kwarg || f.Required != tc.expected.Required || f.Default != tc.expected.Default {
+			t.Errorf("test '%s': expected field %+v but received %+v", tc.name, tc.expected, f)
+		}
+	}
+
+	malformedCases := []struct {
+		name     string
+		typeName string
+		tag      string
+	}{
+		{name: "unknown option", typeName: "int", tag: "n,optional"},
+		{name: "required with default", typeName: "int", tag: "n,required,default=1"},
+		{name: "int default overflow", typeName: "int8", tag: "n,default=128"},
+		{name: "negative uint default", typeName: "uint", tag: "n,default=-1"},
+		{name: "malformed bool default", typeName: "bool", tag: "b,default=yes"},
+		{name: "slice default", typeName: "[]string", tag: "s,default=a"},
+	}
+	for _, tc := range malformedCases {
+		if _, err := parseField("f", tc.typeName, tc.tag); err == nil {
+			t.Errorf("test '%s': expected tag %q of %s field to be refused", tc.name, tc.tag, tc.typeName)
+		}
+	}
+	if _, err := parseTask("testdata", "missingTask"); err == nil {
+		t.Errorf("expected missing task to be refused")
+	}
+}
@@ -0,0 +1,16 @@
+package tasks
+
+import "time"
+
+// orderTask is test task with keyword arguments of several types
+type orderTask struct {
+	item     string            `celery:"item,required"`
+	quantity int               `celery:"quantity,default=1"`
+	price    float32           `celery:"price"`
+	express  bool              `celery:",default=true"`
+	tags     []string          `celery:"tags"`
+	due      *time.Time        `celery:"due"`
+	attrs    map[string]uint16 `celery:"attrs"`
+	note     string            `celery:"-"`
+	internal int
+}
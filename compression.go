@@ -0,0 +1,194 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses task message bodies like kombu compression methods.
+// Compressed messages carry content type of compressor in compression header.
+type Compressor interface {
+	ContentType() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	compressors     = map[string]Compressor{}
+	compressorNames = map[string]string{}
+	compressorsLock sync.RWMutex
+)
+
+func init() {
+	// kombu registers zlib format under gzip content type and name
+	RegisterCompressor("zlib", zlibCompressor{})
+	RegisterCompressor("gzip", zlibCompressor{})
+	RegisterCompressor("bzip2", bzip2Compressor{})
+	RegisterCompressor("bzip", bzip2Compressor{})
+	RegisterCompressor("zstd", zstdCompressor{})
+	RegisterCompressor("zstandard", zstdCompressor{})
+}
+
+// RegisterCompressor registers compressor under given name such as kombu compression method
+// and its content type, replacing compressor previously registered for them
+func RegisterCompressor(name string, compressor Compressor) {
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	compressors[compressor.ContentType()] = compressor
+	compressorNames[name] = compressor.ContentType()
+}
+
+// GetCompressor returns compressor registered under given name or content type
+func GetCompressor(name string) (Compressor, error) {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	contentType, ok := compressorNames[name]
+	if !ok {
+		contentType = name
+	}
+	compressor, ok := compressors[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression %s", name)
+	}
+	return compressor, nil
+}
+
+// decompressHeader decompresses data compressed by method given in compression header value.
+// Data is returned unchanged when header is missing.
+func decompressHeader(data []byte, compression interface{}) ([]byte, error) {
+	if compression == nil {
+		return data, nil
+	}
+	name, ok := compression.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid compression header %v", compression)
+	}
+	if name == "" {
+		return data, nil
+	}
+	compressor, err := GetCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return compressor.Decompress(data)
+}
+
+// zlibCompressor is compatible with kombu zlib and gzip compression
+// which both produce zlib format. Gzip format is accepted when decompressing.
+type zlibCompressor struct{}
+
+func (zlibCompressor) ContentType() string {
+	return "application/x-gzip"
+}
+
+func (zlibCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (zlibCompressor) Decompress(data []byte) ([]byte, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// bzip2Compressor is compatible with kombu bzip2 compression
+type bzip2Compressor struct{}
+
+func (bzip2Compressor) ContentType() string {
+	return "application/x-bz2"
+}
+
+func (bzip2Compressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := bzip2.NewWriter(&buf, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (bzip2Compressor) Decompress(data []byte) ([]byte, error) {
+	r, err := bzip2.NewReader(bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// zstdCompressor is compatible with kombu zstd compression
+type zstdCompressor struct{}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCoders creates zstd encoder and decoder shared by all messages
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+func (zstdCompressor) ContentType() string {
+	return "application/zstd"
+}
+
+func (zstdCompressor) Compress(data []byte) ([]byte, error) {
+	encoder, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(data, nil), nil
+}
+
+func (zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	_, decoder, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeAll(data, nil)
+}
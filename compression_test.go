@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestCompressionKombuMessages tests decompression of task messages compressed by kombu
+func TestCompressionKombuMessages(t *testing.T) {
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(`{"id": "x", "task": "add", "args": [1, 2], "kwargs": {}}`))
+	w.Close()
+	testCases := []struct {
+		name        string
+		compression string
+		body        string
+	}{
+		{
+			// base64.b64encode(zlib.compress(body))
+			name:        "zlib",
+			compression: "application/x-gzip",
+			body:        "eJyrVspMUbJSUKpQ0lFQKkkszgZxElNSQNzEovRiIDfaUEfBKBbIzy6HilTX1gIAqB0PmQ==",
+		},
+		{
+			name:        "gzip",
+			compression: "application/x-gzip",
+			body:        base64.StdEncoding.EncodeToString(gzipped.Bytes()),
+		},
+		{
+			// base64.b64encode(bz2.compress(body))
+			name:        "bzip2",
+			compression: "application/x-bz2",
+			body:        "QlpoOTFBWSZTWUVUoz8AABobgFAEMBAACiSoHMogAFCmE00BpiDU/UUaGaTGo5egC83hsqqkp3BaOHSIZTNt6lVwOpQ2T6DX4u5IpwoSCKqUZ+A=",
+		},
+	}
+	for _, tc := range testCases {
+		celeryMessage := getCeleryMessage(tc.body)
+		celeryMessage.Headers = map[string]interface{}{"compression": tc.compression}
+		taskMessage := celeryMessage.GetTaskMessage()
+		releaseCeleryMessage(celeryMessage)
+		if taskMessage == nil {
+			t.Errorf("test '%s': failed to decode compressed task message", tc.name)
+			continue
+		}
+		if taskMessage.ID != "x" || taskMessage.Task != "add" || len(taskMessage.Args) != 2 {
+			t.Errorf("test '%s': received unexpected task message %+v", tc.name, taskMessage)
+		}
+		releaseTaskMessage(taskMessage)
+	}
+
+	celeryMessage := getCeleryMessage(testCases[0].body)
+	celeryMessage.Headers = map[string]interface{}{"compression": "application/x-lzma"}
+	if taskMessage := celeryMessage.GetTaskMessage(); taskMessage != nil {
+		t.Errorf("expected message with unsupported compression to be rejected")
+	}
+	releaseCeleryMessage(celeryMessage)
+}
+
+// TestCompressionClient tests sending compressed tasks to worker
+func TestCompressionClient(t *testing.T) {
+	for _, name := range []string{"zlib", "gzip", "bzip2", "zstd", ""} {
+		broker := NewMemoryBroker()
+		backend := NewMemoryBackend()
+		client, _ := NewCeleryClient(broker, backend, 1)
+		if err := client.SetCompression(name); err != nil {
+			t.Errorf("test '%s': failed to set compression: %v", name, err)
+			continue
+		}
+		taskName := uuid.Must(uuid.NewV4()).String()
+		client.Register(taskName, add)
+		asyncResult, err := client.Delay(taskName, 1, 2)
+		if err != nil {
+			t.Errorf("test '%s': failed to send task: %v", name, err)
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		client.StartWorkerWithContext(ctx)
+		res, err := asyncResult.Get(5 * time.Second)
+		client.StopWorker()
+		cancel()
+		if err != nil {
+			t.Errorf("test '%s': failed to get result: %v", name, err)
+			continue
+		}
+		if fmt.Sprint(res) != "3" {
+			t.Errorf("test '%s': expected result 3 but received %v", name, res)
+		}
+	}
+	client, _ := NewCeleryClient(NewMemoryBroker(), NewMemoryBackend(), 1)
+	if err := client.SetCompression("lzma"); err == nil {
+		t.Errorf("expected unregistered compression to be rejected")
+	}
+}
@@ -5,29 +5,423 @@
 package gocelery
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// GetRealValue returns real value of reflect.Value
-// Required for JSON Marshalling
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeArgLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02 15:04:05.999999", "2006-01-02"}
+)
+
+// GetRealValue returns value of reflect.Value encoded as json value of task result.
+// It returns nil for values which cannot be encoded as json.
 func GetRealValue(val *reflect.Value) interface{} {
-	if val == nil {
+	if val == nil || !val.IsValid() {
 		return nil
 	}
-	switch val.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return val.Int()
-	case reflect.String:
-		return val.String()
-	case reflect.Bool:
-		return val.Bool()
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return val.Uint()
-	case reflect.Float32, reflect.Float64:
-		return val.Float()
-	case reflect.Slice, reflect.Map:
-		return val.Interface()
-	default:
+	encoded, err := encodeResultValue(val.Interface())
+	if err != nil {
 		return nil
 	}
+	return encoded
+}
+
+// encodeResultValue encodes task result as json value using json.Marshaler implementations
+// and json tags of structs, so that results are stored the same way by all backends.
+// Times are encoded in ISO 8601 format and uuids and decimals as strings like celery does.
+func encodeResultValue(val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	encoded, err := toJSONValue(val)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result of type %T: %v", val, err)
+	}
+	return encoded, nil
+}
+
+// ConvertArgument converts task argument decoded from message into value of type t.
+// Arguments are converted through their json encoding, so that numbers decoded as float64
+// are converted to any numeric type and maps and slices to structs, typed maps and slices.
+// Strings are converted to time.Time using RFC 3339 and python isoformat layouts
+// and to []byte as they are. Values of types tagged by kombu json encoder are converted as strings.
+func ConvertArgument(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	arg = unwrapKombuTypes(arg)
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use null as %s", t)
+	}
+	val := reflect.ValueOf(arg)
+	if val.Type().AssignableTo(t) {
+		return val, nil
+	}
+	if s, ok := arg.(string); ok {
+		switch {
+		case t == timeType:
+			tm, err := parseTimeArgument(s)
+			return reflect.ValueOf(tm), err
+		case t.Kind() == reflect.Ptr && t.Elem() == timeType:
+			tm, err := parseTimeArgument(s)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(&tm), nil
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && t != rawMessageType:
+			return reflect.ValueOf([]byte(s)).Convert(t), nil
+		}
+	}
+	data, err := json.Marshal(arg)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s: %s", data, t, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return ptr.Elem(), nil
+}
+
+// StringArgument converts task argument into string
+func StringArgument(arg interface{}) (string, error) {
+	if s, ok := arg.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("cannot use %v (%T) as string", arg, arg)
+}
+
+// BoolArgument converts task argument into bool
+func BoolArgument(arg interface{}) (bool, error) {
+	if b, ok := arg.(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("cannot use %v (%T) as bool", arg, arg)
+}
+
+// IntArgument converts task argument into integer of given bit size.
+// Numbers decoded as float64 must be integral, bit size 0 means int.
+func IntArgument(arg interface{}, bitSize int) (int64, error) {
+	typeName := "int"
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	} else {
+		typeName += strconv.Itoa(bitSize)
+	}
+	var n int64
+	switch v := arg.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+		}
+		n = int64(v)
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+		}
+		n = i
+	default:
+		val := reflect.ValueOf(arg)
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = val.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if val.Uint() > math.MaxInt64 {
+				return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+			}
+			n = int64(val.Uint())
+		default:
+			return 0, fmt.Errorf("cannot use %v (%T) as %s", arg, arg, typeName)
+		}
+	}
+	if bitSize < 64 && (n < -1<<(bitSize-1) || n >= 1<<(bitSize-1)) {
+		return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+	}
+	return n, nil
+}
+
+// UintArgument converts task argument into unsigned integer of given bit size.
+// Numbers decoded as float64 must be integral, bit size 0 means uint.
+func UintArgument(arg interface{}, bitSize int) (uint64, error) {
+	typeName := "uint"
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	} else {
+		typeName += strconv.Itoa(bitSize)
+	}
+	var n uint64
+	switch v := arg.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+			return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+		}
+		n = uint64(v)
+	case json.Number:
+		u, err := strconv.ParseUint(string(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+		}
+		n = u
+	default:
+		val := reflect.ValueOf(arg)
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if val.Int() < 0 {
+				return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+			}
+			n = uint64(val.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n = val.Uint()
+		default:
+			return 0, fmt.Errorf("cannot use %v (%T) as %s", arg, arg, typeName)
+		}
+	}
+	if bitSize < 64 && n >= 1<<bitSize {
+		return 0, fmt.Errorf("cannot use %v as %s", arg, typeName)
+	}
+	return n, nil
+}
+
+// FloatArgument converts task argument into float of given bit size
+func FloatArgument(arg interface{}, bitSize int) (float64, error) {
+	var f float64
+	switch v := arg.(type) {
+	case float64:
+		f = v
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("cannot use %v as float%d", arg, bitSize)
+		}
+		f = parsed
+	default:
+		val := reflect.ValueOf(arg)
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(val.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			f = float64(val.Uint())
+		case reflect.Float32:
+			f = val.Float()
+		default:
+			return 0, fmt.Errorf("cannot use %v (%T) as float%d", arg, arg, bitSize)
+		}
+	}
+	if bitSize == 32 && math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+		return 0, fmt.Errorf("cannot use %v as float32", arg)
+	}
+	return f, nil
+}
+
+// parseTimeArgument parses time argument formatted by go or python isoformat
+func parseTimeArgument(s string) (time.Time, error) {
+	for _, layout := range timeArgLayouts {
+		if tm, err := time.Parse(layout, s); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot use %q as time.Time", s)
+}
+
+// bindTaskArguments converts positional and keyword arguments of task message into arguments of function.
+// Keyword arguments are bound like python to parameters named by argNames
+// or to fields of single struct parameter named by their celery or json tags.
+func bindTaskArguments(funcType reflect.Type, args []interface{}, kwargs map[string]interface{}, argNames []string) ([]reflect.Value, error) {
+	switch {
+	case len(kwargs) == 0:
+		return bindPositionalArguments(funcType, args)
+	case argNames != nil:
+		return bindNamedArguments(funcType, args, kwargs, argNames)
+	case isStructArgumentFunc(funcType):
+		return bindStructArguments(funcType.In(0), args, kwargs)
+	}
+	return nil, fmt.Errorf("keyword arguments require parameter names registered with WithArgNames or single struct parameter")
+}
+
+// bindPositionalArguments converts positional arguments into arguments of function
+func bindPositionalArguments(funcType reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	numArgs := funcType.NumIn()
+	messageNumArgs := len(args)
+	if funcType.IsVariadic() && messageNumArgs < numArgs-1 {
+		return nil, fmt.Errorf("Number of task arguments %d is greater than number of message arguments %d", numArgs-1, messageNumArgs)
+	}
+	if !funcType.IsVariadic() && numArgs != messageNumArgs {
+		return nil, fmt.Errorf("Number of task arguments %d does not match number of message arguments %d", numArgs, messageNumArgs)
+	}
+	in := make([]reflect.Value, messageNumArgs)
+	for i, arg := range args {
+		val, err := ConvertArgument(arg, argumentType(funcType, i))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
+		in[i] = val
+	}
+	return in, nil
+}
+
+// bindNamedArguments binds positional arguments first and keyword arguments to remaining named parameters.
+// Variadic parameter receives extra positional arguments only.
+func bindNamedArguments(funcType reflect.Type, args []interface{}, kwargs map[string]interface{}, argNames []string) ([]reflect.Value, error) {
+	numFixed := funcType.NumIn()
+	if funcType.IsVariadic() {
+		numFixed--
+	}
+	if !funcType.IsVariadic() && len(args) > numFixed {
+		return nil, fmt.Errorf("takes %d positional arguments but %d were given", numFixed, len(args))
+	}
+	in := make([]reflect.Value, numFixed, len(args)+numFixed)
+	for i, arg := range args {
+		val, err := ConvertArgument(arg, argumentType(funcType, i))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
+		if i < numFixed {
+			in[i] = val
+		} else {
+			in = append(in, val)
+		}
+	}
+	for name, arg := range kwargs {
+		i := indexOf(argNames[:numFixed], name)
+		if i < 0 {
+			return nil, fmt.Errorf("unexpected keyword argument %s", name)
+		}
+		if in[i].IsValid() {
+			return nil, fmt.Errorf("multiple values for argument %s", name)
+		}
+		val, err := ConvertArgument(arg, funcType.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument %s: %v", name, err)
+		}
+		in[i] = val
+	}
+	for i := 0; i < numFixed; i++ {
+		if !in[i].IsValid() {
+			return nil, fmt.Errorf("missing argument %s", argNames[i])
+		}
+	}
+	return in, nil
+}
+
+// bindStructArguments binds positional arguments to struct fields in order of declaration
+// and keyword arguments to struct fields by name. Fields without arguments keep zero values.
+func bindStructArguments(t reflect.Type, args []interface{}, kwargs map[string]interface{}) ([]reflect.Value, error) {
+	structType := t
+	if t.Kind() == reflect.Ptr {
+		structType = t.Elem()
+	}
+	fields := structArgumentFields(structType)
+	if len(args) > len(fields) {
+		return nil, fmt.Errorf("takes %d positional arguments but %d were given", len(fields), len(args))
+	}
+	ptr := reflect.New(structType)
+	bound := map[string]bool{}
+	for i, arg := range args {
+		if err := setStructArgument(ptr.Elem(), fields[i], arg); err != nil {
+			return nil, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
+		bound[fields[i].name] = true
+	}
+	for name, arg := range kwargs {
+		var field *structArgumentField
+		for i := range fields {
+			if fields[i].name == name {
+				field = &fields[i]
+				break
+			}
+		}
+		if field == nil {
+			return nil, fmt.Errorf("unexpected keyword argument %s", name)
+		}
+		if bound[name] {
+			return nil, fmt.Errorf("multiple values for argument %s", name)
+		}
+		if err := setStructArgument(ptr.Elem(), *field, arg); err != nil {
+			return nil, fmt.Errorf("invalid argument %s: %v", name, err)
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		return []reflect.Value{ptr}, nil
+	}
+	return []reflect.Value{ptr.Elem()}, nil
+}
+
+// structArgumentField is struct field bound to argument of given name
+type structArgumentField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// structArgumentFields returns exported fields of struct named by celery tag, json tag or field name
+func structArgumentFields(t reflect.Type) []structArgumentField {
+	var fields []structArgumentField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		tag, ok := field.Tag.Lookup("celery")
+		if !ok {
+			tag = field.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		if tag = strings.Split(tag, ",")[0]; tag != "" {
+			name = tag
+		}
+		fields = append(fields, structArgumentField{name: name, index: field.Index, typ: field.Type})
+	}
+	return fields
+}
+
+// setStructArgument converts argument and sets it to struct field
+func setStructArgument(v reflect.Value, field structArgumentField, arg interface{}) error {
+	val, err := ConvertArgument(arg, field.typ)
+	if err != nil {
+		return err
+	}
+	v.FieldByIndex(field.index).Set(val)
+	return nil
+}
+
+// isStructArgumentFunc reports whether function takes single struct or struct pointer argument
+func isStructArgumentFunc(funcType reflect.Type) bool {
+	if funcType.NumIn() != 1 || funcType.IsVariadic() {
+		return false
+	}
+	t := funcType.In(0)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// argumentType returns type of i-th argument of function including variadic arguments
+func argumentType(funcType reflect.Type, i int) reflect.Type {
+	if funcType.IsVariadic() && i >= funcType.NumIn()-1 {
+		return funcType.In(funcType.NumIn() - 1).Elem()
+	}
+	return funcType.In(i)
+}
+
+// indexOf returns index of s in list or -1
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
 }
@@ -0,0 +1,279 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type convertPoint struct {
+	X    int64             `json:"x"`
+	Y    int64             `json:"y"`
+	Tags map[string]uint16 `json:"tags"`
+}
+
+// TestConvertArgument tests conversion of json decoded arguments into parameter types
+func TestConvertArgument(t *testing.T) {
+	eta := time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)
+	testCases := []struct {
+		name     string
+		arg      interface{}
+		expected interface{}
+	}{
+		{name: "int64", arg: float64(1 << 40), expected: int64(1 << 40)},
+		{name: "uint", arg: float64(42), expected: uint(42)},
+		{name: "float32", arg: 1.5, expected: float32(1.5)},
+		{name: "string slice", arg: []interface{}{"a", "b"}, expected: []string{"a", "b"}},
+		{name: "int map", arg: map[string]interface{}{"a": 1.0}, expected: map[string]int{"a": 1}},
+		{
+			name:     "struct",
+			arg:      map[string]interface{}{"x": 1.0, "y": 2.0, "tags": map[string]interface{}{"z": 3.0}},
+			expected: convertPoint{X: 1, Y: 2, Tags: map[string]uint16{"z": 3}},
+		},
+		{name: "struct pointer", arg: map[string]interface{}{"x": 1.0}, expected: &convertPoint{X: 1}},
+		{name: "nested slice", arg: []interface{}{[]interface{}{1.0}, nil}, expected: [][]int8{{1}, nil}},
+		{name: "nil pointer", arg: nil, expected: (*convertPoint)(nil)},
+		{name: "nil map", arg: nil, expected: map[string]int(nil)},
+		{name: "interface", arg: 1.0, expected: interface{}(1.0)},
+		{name: "time", arg: "2021-03-04T05:06:07.123456Z", expected: eta},
+		{name: "python isoformat time", arg: "2021-03-04T05:06:07.123456", expected: eta},
+		{name: "time pointer", arg: "2021-03-04T05:06:07.123456+00:00", expected: &eta},
+		{name: "raw message", arg: map[string]interface{}{"a": 1.0}, expected: json.RawMessage(`{"a":1}`)},
+		{name: "bytes", arg: "gopher", expected: []byte("gopher")},
+	}
+	for _, tc := range testCases {
+		expectedType := reflect.TypeOf(tc.expected)
+		if expectedType == nil {
+			expectedType = reflect.TypeOf((*interface{})(nil)).Elem()
+		}
+		val, err := ConvertArgument(tc.arg, expectedType)
+		if err != nil {
+			t.Errorf("test '%s': failed to convert argument %v: %v", tc.name, tc.arg, err)
+			continue
+		}
+		if tm, ok := tc.expected.(time.Time); ok {
+			if !tm.Equal(val.Interface().(time.Time)) {
+				t.Errorf("test '%s': expected time %v but received %v", tc.name, tm, val)
+			}
+			continue
+		}
+		if tm, ok := tc.expected.(*time.Time); ok {
+			if !tm.Equal(*val.Interface().(*time.Time)) {
+				t.Errorf("test '%s': expected time %v but received %v", tc.name, tm, val)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(tc.expected, val.Interface()) {
+			t.Errorf("test '%s': expected argument %#v but received %#v", tc.name, tc.expected, val.Interface())
+		}
+	}
+}
+
+// TestConvertArgumentMismatch tests refusal of arguments not convertible to parameter types
+func TestConvertArgumentMismatch(t *testing.T) {
+	testCases := []struct {
+		name string
+		arg  interface{}
+		t    reflect.Type
+	}{
+		{name: "fraction as int", arg: 3.5, t: reflect.TypeOf(0)},
+		{name: "negative as uint", arg: -1.0, t: reflect.TypeOf(uint(0))},
+		{name: "overflow", arg: 300.0, t: reflect.TypeOf(int8(0))},
+		{name: "null as int", arg: nil, t: reflect.TypeOf(0)},
+		{name: "string as int", arg: "1", t: reflect.TypeOf(0)},
+		{name: "mistyped slice", arg: []interface{}{1.0}, t: reflect.TypeOf([]string{})},
+		{name: "malformed time", arg: "yesterday", t: reflect.TypeOf(time.Time{})},
+	}
+	for _, tc := range testCases {
+		if val, err := ConvertArgument(tc.arg, tc.t); err == nil {
+			t.Errorf("test '%s': expected conversion of %v to %s to fail but received %v", tc.name, tc.arg, tc.t, val)
+		}
+	}
+}
+
+// TestConvertTaskArguments tests running tasks with arguments of any type
+func TestConvertTaskArguments(t *testing.T) {
+	celeryWorker := NewCeleryWorker(NewMemoryBroker(), NewMemoryBackend(), 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(taskName, func(p *convertPoint, scale uint, names ...string) int64 {
+		if p == nil {
+			return int64(len(names))
+		}
+		return (p.X + p.Y) * int64(scale)
+	})
+	testCases := []struct {
+		name     string
+		args     []interface{}
+		expected int64
+	}{
+		{name: "struct pointer", args: []interface{}{map[string]interface{}{"x": 1.0, "y": 2.0}, 2.0}, expected: 6},
+		{name: "variadic arguments", args: []interface{}{nil, 1.0, "a", "b"}, expected: 2},
+	}
+	for _, tc := range testCases {
+		message := &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: tc.args}
+		res, err := celeryWorker.RunTask(message)
+		if err != nil {
+			t.Errorf("test '%s': failed to run task: %v", tc.name, err)
+			continue
+		}
+		if res.Result != tc.expected {
+			t.Errorf("test '%s': expected result %v but received %v", tc.name, tc.expected, res.Result)
+		}
+	}
+
+	message := &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{nil, -1.0}}
+	if _, err := celeryWorker.RunTask(message); err == nil || !strings.Contains(err.Error(), "argument 1") {
+		t.Errorf("expected negative argument to be refused with argument error but received %v", err)
+	}
+	message = &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{nil}}
+	if _, err := celeryWorker.RunTask(message); err == nil {
+		t.Errorf("expected missing argument to be refused")
+	}
+}
+
+type convertOrder struct {
+	Item     string  `celery:"item" json:"name"`
+	Quantity uint    `json:"quantity,omitempty"`
+	Price    float32 `json:"price"`
+	Note     string  `json:"-"`
+}
+
+// TestConvertTaskKwargs tests binding keyword arguments of function tasks
+func TestConvertTaskKwargs(t *testing.T) {
+	celeryWorker := NewCeleryWorker(NewMemoryBroker(), NewMemoryBackend(), 1)
+	namedTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(namedTask, func(item string, quantity int, tags ...string) string {
+		return fmt.Sprintf("%s x%d %v", item, quantity, tags)
+	}, WithArgNames("item", "quantity", "tags"))
+	structTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(structTask, func(order *convertOrder) string {
+		return fmt.Sprintf("%s x%d %.2f", order.Item, order.Quantity, order.Price)
+	})
+	plainTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(plainTask, add)
+
+	testCases := []struct {
+		name     string
+		task     string
+		args     []interface{}
+		kwargs   map[string]interface{}
+		expected string
+	}{
+		{name: "keyword arguments", task: namedTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"quantity": 2.0, "item": "apple"}, expected: "apple x2 []"},
+		{name: "mixed arguments", task: namedTask, args: []interface{}{"apple"},
+			kwargs: map[string]interface{}{"quantity": 3.0}, expected: "apple x3 []"},
+		{name: "variadic arguments", task: namedTask, args: []interface{}{"apple", 1.0, "red", "ripe"},
+			expected: "apple x1 [red ripe]"},
+		{name: "struct keyword arguments", task: structTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"item": "pear", "quantity": 4.0, "price": 0.5}, expected: "pear x4 0.50"},
+		{name: "struct mixed arguments", task: structTask, args: []interface{}{"pear"},
+			kwargs: map[string]interface{}{"price": 1.25}, expected: "pear x0 1.25"},
+		{name: "struct positional argument", task: structTask, args: []interface{}{map[string]interface{}{"name": "plum"}},
+			expected: "plum x0 0.00"},
+	}
+	for _, tc := range testCases {
+		message := &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: tc.task, Args: tc.args, Kwargs: tc.kwargs}
+		res, err := celeryWorker.RunTask(message)
+		if err != nil {
+			t.Errorf("test '%s': failed to run task: %v", tc.name, err)
+			continue
+		}
+		if res.Result != tc.expected {
+			t.Errorf("test '%s': expected result %v but received %v", tc.name, tc.expected, res.Result)
+		}
+	}
+
+	malformedCases := []struct {
+		name   string
+		task   string
+		args   []interface{}
+		kwargs map[string]interface{}
+		err    string
+	}{
+		{name: "missing argument", task: namedTask, args: []interface{}{"apple"}, err: "Number of task arguments"},
+		{name: "missing keyword argument", task: namedTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"item": "apple"}, err: "missing argument quantity"},
+		{name: "unexpected keyword argument", task: namedTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"item": "apple", "quantity": 1.0, "color": "red"}, err: "unexpected keyword argument color"},
+		{name: "variadic keyword argument", task: namedTask, args: []interface{}{"apple", 1.0},
+			kwargs: map[string]interface{}{"tags": []interface{}{"red"}}, err: "unexpected keyword argument tags"},
+		{name: "multiple values", task: namedTask, args: []interface{}{"apple"},
+			kwargs: map[string]interface{}{"item": "pear", "quantity": 1.0}, err: "multiple values for argument item"},
+		{name: "mistyped keyword argument", task: namedTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"item": "apple", "quantity": "two"}, err: "invalid argument quantity"},
+		{name: "struct multiple values", task: structTask, args: []interface{}{"pear"},
+			kwargs: map[string]interface{}{"item": "plum"}, err: "multiple values for argument item"},
+		{name: "struct ignored field", task: structTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"Note": "fragile"}, err: "unexpected keyword argument Note"},
+		{name: "unnamed parameters", task: plainTask, args: []interface{}{},
+			kwargs: map[string]interface{}{"a": 1.0, "b": 2.0}, err: "WithArgNames"},
+	}
+	for _, tc := range malformedCases {
+		message := &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: tc.task, Args: tc.args, Kwargs: tc.kwargs}
+		if _, err := celeryWorker.RunTask(message); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("test '%s': expected error %q but received %v", tc.name, tc.err, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering task with wrong number of argument names to panic")
+		}
+	}()
+	celeryWorker.Register(namedTask, add, WithArgNames("a"))
+}
+
+// TestConvertBasicArguments tests conversion of arguments into basic types used by generated tasks
+func TestConvertBasicArguments(t *testing.T) {
+	if n, err := IntArgument(42.0, 8); err != nil || n != 42 {
+		t.Errorf("expected int8 42 but received %v: %v", n, err)
+	}
+	if n, err := IntArgument(int64(-1), 0); err != nil || n != -1 {
+		t.Errorf("expected int -1 but received %v: %v", n, err)
+	}
+	if n, err := IntArgument(json.Number("7"), 64); err != nil || n != 7 {
+		t.Errorf("expected int64 7 but received %v: %v", n, err)
+	}
+	if n, err := UintArgument(uint16(65535), 16); err != nil || n != 65535 {
+		t.Errorf("expected uint16 65535 but received %v: %v", n, err)
+	}
+	if f, err := FloatArgument(3, 32); err != nil || f != 3 {
+		t.Errorf("expected float32 3 but received %v: %v", f, err)
+	}
+	if s, err := StringArgument("gopher"); err != nil || s != "gopher" {
+		t.Errorf("expected string gopher but received %v: %v", s, err)
+	}
+	if b, err := BoolArgument(true); err != nil || !b {
+		t.Errorf("expected bool true but received %v: %v", b, err)
+	}
+
+	malformedCases := []struct {
+		name string
+		fn   func() error
+	}{
+		{name: "fraction as int", fn: func() error { _, err := IntArgument(1.5, 0); return err }},
+		{name: "int8 overflow", fn: func() error { _, err := IntArgument(128.0, 8); return err }},
+		{name: "string as int", fn: func() error { _, err := IntArgument("1", 0); return err }},
+		{name: "negative uint", fn: func() error { _, err := UintArgument(-1.0, 0); return err }},
+		{name: "uint8 overflow", fn: func() error { _, err := UintArgument(256, 8); return err }},
+		{name: "float32 overflow", fn: func() error { _, err := FloatArgument(1e39, 32); return err }},
+		{name: "null as float", fn: func() error { _, err := FloatArgument(nil, 64); return err }},
+		{name: "number as string", fn: func() error { _, err := StringArgument(1.0); return err }},
+		{name: "string as bool", fn: func() error { _, err := BoolArgument("true"); return err }},
+	}
+	for _, tc := range malformedCases {
+		if err := tc.fn(); err == nil {
+			t.Errorf("test '%s': expected conversion to fail", tc.name)
+		}
+	}
+}
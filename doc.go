@@ -13,6 +13,13 @@ Supported brokers/backends
 
     * Redis (broker/backend)
     * AMQP (broker/backend)
+    * Redis Streams (broker, go only)
+    * SQL databases (broker/backend)
+    * Filesystem (broker/backend)
+    * MongoDB (backend, package celerymongo)
+    * NATS JetStream (broker/backend, go only, package celerynats)
+    * Kafka (broker, go only, package celerykafka)
+    * Amazon SQS (broker, package celerysqs)
 
 Celery must be configured to use json instead of default pickle encoding. This is because Go currently has no stable support for decoding pickle objects. Pass below configuration parameters to use json.
 
@@ -20,5 +27,11 @@ Celery must be configured to use json instead of default pickle encoding. This i
     CELERY_ACCEPT_CONTENT=['json']  # Ignore other content
     CELERY_RESULT_SERIALIZER='json'
     CELERY_ENABLE_UTC=True
+
+Task messages may also be serialized with msgpack or yaml using CeleryClient.SetSerializer
+and accepted by workers using CeleryClient.SetAcceptContent.
+Task messages are compressed with zlib, bzip2 or zstd using CeleryClient.SetCompression
+and signed with celery auth serializer using CeleryClient.SetupSecurity.
+Task messages and results are encrypted with AES-GCM using CeleryClient.SetEncryption.
 */
 package gocelery
@@ -0,0 +1,356 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// EncryptedContentType is content type of encrypted task messages.
+// Workers without encryption keys refuse messages of this content type.
+const EncryptedContentType = "application/x-gocelery-encrypted"
+
+// encryptionAlgorithm identifies encrypted payloads
+const encryptionAlgorithm = "aes-gcm"
+
+// KeyProvider provides AES keys of EncryptionCodec identified by key ids.
+// Keys are rotated by encrypting with new current key while keeping old keys for decryption.
+type KeyProvider interface {
+	// CurrentKey returns id and key used to encrypt new payloads
+	CurrentKey() (string, []byte, error)
+	// Key returns key with given id used to decrypt payloads
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider is KeyProvider with fixed set of 16, 24 or 32 bytes long AES keys
+type StaticKeyProvider struct {
+	CurrentID string
+	Keys      map[string][]byte
+
+	lock sync.RWMutex
+}
+
+// NewStaticKeyProvider creates new StaticKeyProvider encrypting with given key
+func NewStaticKeyProvider(currentID string, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{
+		CurrentID: currentID,
+		Keys:      map[string][]byte{currentID: key},
+	}
+}
+
+// Rotate adds new key and makes it current key, keeping previous keys for decryption
+func (p *StaticKeyProvider) Rotate(id string, key []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.Keys[id] = key
+	p.CurrentID = id
+}
+
+// CurrentKey returns current key
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	key, ok := p.Keys[p.CurrentID]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown encryption key %s", p.CurrentID)
+	}
+	return p.CurrentID, key, nil
+}
+
+// Key returns key with given id
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %s", id)
+	}
+	return key, nil
+}
+
+// encryptedPayload is json envelope of encrypted data
+type encryptedPayload struct {
+	Encryption  string `json:"encryption"`
+	KeyID       string `json:"kid"`
+	ContentType string `json:"content_type"`
+	Nonce       []byte `json:"nonce"`
+	Ciphertext  []byte `json:"ciphertext"`
+}
+
+// EncryptionCodec encrypts task message bodies and results with AES-GCM.
+// Encrypted payloads record id of key and content type of plaintext,
+// which is authenticated together with ciphertext.
+type EncryptionCodec struct {
+	Keys KeyProvider
+}
+
+// NewEncryptionCodec creates new EncryptionCodec with given key provider
+func NewEncryptionCodec(keys KeyProvider) *EncryptionCodec {
+	return &EncryptionCodec{
+		Keys: keys,
+	}
+}
+
+// Encrypt encrypts plaintext of given content type with current key
+func (c *EncryptionCodec) Encrypt(plaintext []byte, contentType string) ([]byte, error) {
+	payload, err := c.encrypt(plaintext, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(payload)
+}
+
+// Decrypt decrypts data encrypted by Encrypt and returns plaintext and its content type
+func (c *EncryptionCodec) Decrypt(data []byte) ([]byte, string, error) {
+	var payload encryptedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, "", fmt.Errorf("invalid encrypted payload: %v", err)
+	}
+	return c.decrypt(&payload)
+}
+
+func (c *EncryptionCodec) encrypt(plaintext []byte, contentType string) (*encryptedPayload, error) {
+	keyID, key, err := c.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &encryptedPayload{
+		Encryption:  encryptionAlgorithm,
+		KeyID:       keyID,
+		ContentType: contentType,
+		Nonce:       nonce,
+		Ciphertext:  aead.Seal(nil, nonce, plaintext, []byte(keyID+contentType)),
+	}, nil
+}
+
+func (c *EncryptionCodec) decrypt(payload *encryptedPayload) ([]byte, string, error) {
+	if payload.Encryption != encryptionAlgorithm {
+		return nil, "", fmt.Errorf("unsupported encryption %s", payload.Encryption)
+	}
+	key, err := c.Keys.Key(payload.KeyID)
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(payload.Nonce) != aead.NonceSize() {
+		return nil, "", fmt.Errorf("invalid nonce of encrypted payload")
+	}
+	plaintext, err := aead.Open(nil, payload.Nonce, payload.Ciphertext, []byte(payload.KeyID+payload.ContentType))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt payload with key %s: %v", payload.KeyID, err)
+	}
+	return plaintext, payload.ContentType, nil
+}
+
+// newAESGCM creates AES-GCM cipher with given key
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedSerializer encrypts task messages serialized by Serializer
+type EncryptedSerializer struct {
+	Serializer Serializer
+	Codec      *EncryptionCodec
+}
+
+// NewEncryptedSerializer creates EncryptedSerializer encrypting messages serialized by given serializer
+func NewEncryptedSerializer(serializer Serializer, keys KeyProvider) *EncryptedSerializer {
+	return &EncryptedSerializer{
+		Serializer: serializer,
+		Codec:      NewEncryptionCodec(keys),
+	}
+}
+
+// ContentType returns EncryptedContentType
+func (s *EncryptedSerializer) ContentType() string {
+	return EncryptedContentType
+}
+
+// ContentEncoding returns content encoding of json encoded encrypted payload
+func (s *EncryptedSerializer) ContentEncoding() string {
+	return "utf-8"
+}
+
+// Marshal serializes and encrypts v
+func (s *EncryptedSerializer) Marshal(v interface{}) ([]byte, error) {
+	data, err := s.Serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.Codec.Encrypt(data, s.Serializer.ContentType())
+}
+
+// Unmarshal decrypts data and deserializes it into v using serializer of its content type
+func (s *EncryptedSerializer) Unmarshal(data []byte, v interface{}) error {
+	plaintext, contentType, err := s.Codec.Decrypt(data)
+	if err != nil {
+		return err
+	}
+	serializer := s.Serializer
+	if contentType != serializer.ContentType() {
+		if serializer, err = GetSerializer(contentType); err != nil {
+			return err
+		}
+	}
+	return serializer.Unmarshal(plaintext, v)
+}
+
+// EncryptedBackend encrypts results and tracebacks stored in Backend.
+// Task state stays readable, so that waiting for results does not require keys.
+type EncryptedBackend struct {
+	Backend CeleryBackend
+	Codec   *EncryptionCodec
+}
+
+// NewEncryptedBackend creates EncryptedBackend storing results in given backend
+func NewEncryptedBackend(backend CeleryBackend, keys KeyProvider) *EncryptedBackend {
+	return &EncryptedBackend{
+		Backend: backend,
+		Codec:   NewEncryptionCodec(keys),
+	}
+}
+
+// GetResult retrieves result from backend and decrypts its value and traceback
+func (b *EncryptedBackend) GetResult(taskID string) (*ResultMessage, error) {
+	result, err := b.Backend.GetResult(taskID)
+	if err != nil || result == nil {
+		return result, err
+	}
+	return b.decryptResult(result)
+}
+
+// GetResults retrieves results of multiple tasks from backend and decrypts them.
+// Results are retrieved one by one if backend does not support batches.
+func (b *EncryptedBackend) GetResults(taskIDs []string) ([]*ResultMessage, error) {
+	results := make([]*ResultMessage, len(taskIDs))
+	backend, ok := b.Backend.(CeleryBatchBackend)
+	if ok {
+		var err error
+		if results, err = backend.GetResults(taskIDs); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, taskID := range taskIDs {
+			result, err := b.Backend.GetResult(taskID)
+			if errors.Is(err, ErrResultNotAvailable) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			results[i] = result
+		}
+	}
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		decrypted, err := b.decryptResult(result)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = decrypted
+	}
+	return results, nil
+}
+
+// ForgetResult removes result from backend if it supports forgetting results
+func (b *EncryptedBackend) ForgetResult(taskID string) error {
+	backend, ok := b.Backend.(CeleryForgettingBackend)
+	if !ok {
+		return fmt.Errorf("backend %T does not support forgetting results", b.Backend)
+	}
+	return backend.ForgetResult(taskID)
+}
+
+// SetResult encrypts value and traceback of result and stores it in backend
+func (b *EncryptedBackend) SetResult(taskID string, result *ResultMessage) error {
+	encrypted := *result
+	var err error
+	if encrypted.Result, err = b.encryptValue(result.Result); err != nil {
+		return err
+	}
+	if encrypted.Traceback, err = b.encryptValue(result.Traceback); err != nil {
+		return err
+	}
+	return b.Backend.SetResult(taskID, &encrypted)
+}
+
+// decryptResult decrypts value and traceback of result retrieved from backend
+func (b *EncryptedBackend) decryptResult(result *ResultMessage) (*ResultMessage, error) {
+	decrypted := *result
+	var err error
+	if decrypted.Result, err = b.decryptValue(result.Result); err != nil {
+		return nil, err
+	}
+	if decrypted.Traceback, err = b.decryptValue(result.Traceback); err != nil {
+		return nil, err
+	}
+	return &decrypted, nil
+}
+
+// encryptValue encrypts json encoding of value and returns encrypted payload as json object
+func (b *EncryptedBackend) encryptValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := b.Codec.encrypt(data, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	return toJSONValue(payload)
+}
+
+// decryptValue decrypts value encrypted by encryptValue.
+// Values which are not encrypted payloads are refused, so that results
+// cannot be replaced with plaintext by anyone able to write to backend.
+func (b *EncryptedBackend) decryptValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok || fields["encryption"] == nil || fields["kid"] == nil {
+		return nil, fmt.Errorf("refusing unencrypted value stored in encrypted backend")
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, _, err := b.Codec.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	var decrypted interface{}
+	if err := json.Unmarshal(plaintext, &decrypted); err != nil {
+		return nil, err
+	}
+	return decrypted, nil
+}
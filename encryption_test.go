@@ -0,0 +1,242 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestEncryptionCodec tests encryption with key rotation
+func TestEncryptionCodec(t *testing.T) {
+	keys := NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	codec := NewEncryptionCodec(keys)
+	plaintext := []byte(`{"email": "gopher@example.com"}`)
+	encrypted, err := codec.Encrypt(plaintext, "application/json")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if bytes.Contains(encrypted, []byte("gopher")) {
+		t.Errorf("expected plaintext not to be readable in %s", encrypted)
+	}
+
+	// payloads encrypted with previous key are decrypted after rotation
+	keys.Rotate("k2", bytes.Repeat([]byte{2}, 32))
+	decrypted, contentType, err := codec.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) || contentType != "application/json" {
+		t.Errorf("received unexpected plaintext %s of content type %s", decrypted, contentType)
+	}
+	rotated, err := codec.Encrypt(plaintext, "application/json")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	var payload encryptedPayload
+	if err := json.Unmarshal(rotated, &payload); err != nil || payload.KeyID != "k2" {
+		t.Errorf("expected payload to be encrypted with rotated key but received %s", rotated)
+	}
+
+	// tampered payloads and payloads of unknown keys are refused
+	payload.ContentType = "application/x-yaml"
+	tampered, _ := json.Marshal(payload)
+	if _, _, err := codec.Decrypt(tampered); err == nil {
+		t.Errorf("expected tampered payload to be refused")
+	}
+	otherCodec := NewEncryptionCodec(NewStaticKeyProvider("k3", bytes.Repeat([]byte{3}, 32)))
+	if _, _, err := otherCodec.Decrypt(encrypted); err == nil {
+		t.Errorf("expected payload of unknown key to be refused")
+	}
+}
+
+// TestEncryptionClient tests that task arguments and results are stored encrypted
+func TestEncryptionClient(t *testing.T) {
+	broker := NewMemoryBroker()
+	backend := NewMemoryBackend()
+	client, _ := NewCeleryClient(broker, backend, 1)
+	if err := client.SetEncryption(NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))); err != nil {
+		t.Fatalf("failed to set up encryption: %v", err)
+	}
+	// keys of other clients of process do not replace keys of client
+	otherClient, _ := NewCeleryClient(NewMemoryBroker(), NewMemoryBackend(), 1)
+	if err := otherClient.SetEncryption(NewStaticKeyProvider("k3", bytes.Repeat([]byte{3}, 32))); err != nil {
+		t.Fatalf("failed to set up encryption of other client: %v", err)
+	}
+	taskName := uuid.Must(uuid.NewV4()).String()
+	client.Register(taskName, addStr)
+
+	asyncResult, err := client.Delay(taskName, "gopher", "@example.com")
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	celeryMessage, err := broker.GetCeleryMessage()
+	if err != nil {
+		t.Fatalf("failed to get celery message: %v", err)
+	}
+	body, _ := base64.StdEncoding.DecodeString(celeryMessage.Body)
+	if celeryMessage.ContentType != EncryptedContentType || bytes.Contains(body, []byte("gopher")) {
+		t.Errorf("expected encrypted task message but received %s of content type %s", body, celeryMessage.ContentType)
+	}
+	if err := broker.SendCeleryMessage(celeryMessage); err != nil {
+		t.Fatalf("failed to send celery message: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartWorkerWithContext(ctx)
+	defer client.StopWorker()
+	res, err := asyncResult.Get(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if res != "gopher@example.com" {
+		t.Errorf("expected decrypted result but received %v", res)
+	}
+	values, err := NewResultSet(NewAsyncResult(asyncResult.TaskID, client.backend)).Join(ctx)
+	if err != nil || len(values) != 1 || values[0] != "gopher@example.com" {
+		t.Errorf("expected decrypted results of result set but received %v: %v", values, err)
+	}
+	stored, err := backend.GetResult(asyncResult.TaskID)
+	if err != nil {
+		t.Fatalf("failed to get stored result: %v", err)
+	}
+	storedBytes, _ := json.Marshal(stored)
+	if stored.Status != "SUCCESS" || strings.Contains(string(storedBytes), "gopher") {
+		t.Errorf("expected result to be stored encrypted but received %s", storedBytes)
+	}
+
+	// results replaced with plaintext in backend are refused
+	plaintextResult := getResultMessage("forged")
+	err = backend.SetResult(asyncResult.TaskID, plaintextResult)
+	releaseResultMessage(plaintextResult)
+	if err != nil {
+		t.Fatalf("failed to set result: %v", err)
+	}
+	if _, err := client.backend.GetResult(asyncResult.TaskID); err == nil {
+		t.Errorf("expected plaintext result in encrypted backend to be refused")
+	}
+
+	// messages encrypted with keys unknown to worker are refused
+	unknownMessage := getCeleryMessage("")
+	defer releaseCeleryMessage(unknownMessage)
+	serializer := NewEncryptedSerializer(jsonSerializer{}, NewStaticKeyProvider("k2", bytes.Repeat([]byte{2}, 32)))
+	taskMessage := getTaskMessage(taskName)
+	unknownMessage.Body, err = taskMessage.EncodeWithSerializer(serializer)
+	releaseTaskMessage(taskMessage)
+	if err != nil {
+		t.Fatalf("failed to encode task message: %v", err)
+	}
+	unknownMessage.ContentType = EncryptedContentType
+	if taskMessage := broker.decodeTaskMessage(unknownMessage); taskMessage != nil {
+		t.Errorf("expected task message encrypted with unknown key to be refused")
+	}
+}
+
+// TestEncryptionClientSetupOrder tests that task messages are encrypted
+// regardless of order of SetEncryption and other client settings
+func TestEncryptionClientSetupOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile, certFile, err := writeTestSigningCertificate(dir, 1)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	keys := NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	setEncryption := func(client *CeleryClient) error {
+		return client.SetEncryption(keys)
+	}
+	setSerializer := func(client *CeleryClient) error {
+		if err := client.SetSerializer("yaml"); err != nil {
+			return err
+		}
+		return client.SetAcceptContent("yaml")
+	}
+	setupSecurity := func(client *CeleryClient) error {
+		return client.SetupSecurity(keyFile, certFile, dir)
+	}
+	testCases := []struct {
+		name        string
+		setup       []func(*CeleryClient) error
+		contentType string
+	}{
+		{
+			name:        "serializer before encryption",
+			setup:       []func(*CeleryClient) error{setSerializer, setEncryption},
+			contentType: "application/x-yaml",
+		},
+		{
+			name:        "serializer after encryption",
+			setup:       []func(*CeleryClient) error{setEncryption, setSerializer},
+			contentType: "application/x-yaml",
+		},
+		{
+			name:        "security after encryption",
+			setup:       []func(*CeleryClient) error{setEncryption, setupSecurity},
+			contentType: "application/data",
+		},
+		{
+			name:        "encryption set twice",
+			setup:       []func(*CeleryClient) error{setEncryption, setSerializer, setEncryption},
+			contentType: "application/x-yaml",
+		},
+	}
+	for _, tc := range testCases {
+		broker := NewMemoryBroker()
+		backend := NewMemoryBackend()
+		client, _ := NewCeleryClient(broker, backend, 1)
+		for _, setup := range tc.setup {
+			if err := setup(client); err != nil {
+				t.Fatalf("test '%s': failed to set up client: %v", tc.name, err)
+			}
+		}
+		taskName := uuid.Must(uuid.NewV4()).String()
+		client.Register(taskName, addStr)
+		asyncResult, err := client.Delay(taskName, "gopher", "@example.com")
+		if err != nil {
+			t.Errorf("test '%s': failed to send task: %v", tc.name, err)
+			continue
+		}
+		celeryMessage, err := broker.GetCeleryMessage()
+		if err != nil {
+			t.Errorf("test '%s': failed to get celery message: %v", tc.name, err)
+			continue
+		}
+		body, _ := base64.StdEncoding.DecodeString(celeryMessage.Body)
+		_, contentType, err := NewEncryptionCodec(keys).Decrypt(body)
+		if celeryMessage.ContentType != EncryptedContentType || err != nil || contentType != tc.contentType {
+			t.Errorf("test '%s': expected encrypted %s task message but received %s message of content type %s: %v",
+				tc.name, tc.contentType, contentType, celeryMessage.ContentType, err)
+		}
+		if err := broker.SendCeleryMessage(celeryMessage); err != nil {
+			t.Errorf("test '%s': failed to send celery message: %v", tc.name, err)
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		client.StartWorkerWithContext(ctx)
+		res, err := asyncResult.Get(5 * time.Second)
+		if err != nil || res != "gopher@example.com" {
+			t.Errorf("test '%s': expected decrypted result but received %v: %v", tc.name, res, err)
+		}
+		client.StopWorker()
+		cancel()
+		if _, ok := client.backend.(*EncryptedBackend).Backend.(*MemoryCeleryBackend); !ok {
+			t.Errorf("test '%s': expected results to be encrypted once", tc.name)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileBackend is celery backend storing results as files in directory.
+// It is compatible with celery file:// result backend,
+// which stores each result as JSON file named celery-task-meta-<task id>.
+type FileBackend struct {
+	Path string
+}
+
+// NewFileBackend creates new FileBackend storing results in given directory.
+// Directory is created if it does not exist.
+func NewFileBackend(path string) (*FileBackend, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &FileBackend{
+		Path: path,
+	}, nil
+}
+
+// GetResult reads result from result file
+func (b *FileBackend) GetResult(taskID string) (*ResultMessage, error) {
+	resBytes, err := ioutil.ReadFile(b.resultFile(taskID))
+	if os.IsNotExist(err) {
+		return nil, ErrResultNotAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resultMessage ResultMessage
+	if err := json.Unmarshal(resBytes, &resultMessage); err != nil {
+		return nil, err
+	}
+	return &resultMessage, nil
+}
+
+// SetResult writes result into result file
+func (b *FileBackend) SetResult(taskID string, result *ResultMessage) error {
+	resBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.resultFile(taskID), resBytes)
+}
+
+// ForgetResult removes result file
+func (b *FileBackend) ForgetResult(taskID string) error {
+	err := os.Remove(b.resultFile(taskID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// resultFile returns path of task result file
+func (b *FileBackend) resultFile(taskID string) string {
+	return filepath.Join(b.Path, fmt.Sprintf("celery-task-meta-%s", taskID))
+}
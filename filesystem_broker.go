@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// FilesystemBroker is celery broker storing messages as files in directories.
+// It is compatible with kombu filesystem transport:
+// messages are written to FolderOut as <timestamp>_<uuid>.<queue>.msg files
+// and claimed from FolderIn by atomically renaming them into ProcessedFolder,
+// so that only one worker receives each message.
+type FilesystemBroker struct {
+	QueueName string
+	// FolderIn is directory messages are consumed from (kombu data_folder_in)
+	FolderIn string
+	// FolderOut is directory messages are sent to (kombu data_folder_out)
+	FolderOut string
+	// ProcessedFolder is directory claimed messages are moved to.
+	// It must be on the same filesystem as FolderIn.
+	ProcessedFolder string
+	// StoreProcessed keeps claimed messages in ProcessedFolder instead of removing them
+	StoreProcessed bool
+
+	brokerSerializers
+}
+
+// NewFilesystemBroker creates new FilesystemBroker consuming messages from folderIn
+// and sending messages to folderOut. Directories are created if they do not exist.
+// Worker and client sharing the same queue should use the same directory for both.
+func NewFilesystemBroker(folderIn, folderOut string) (*FilesystemBroker, error) {
+	broker := &FilesystemBroker{
+		QueueName:       "celery",
+		FolderIn:        folderIn,
+		FolderOut:       folderOut,
+		ProcessedFolder: filepath.Join(folderIn, "processed"),
+	}
+	for _, folder := range []string{broker.FolderIn, broker.FolderOut, broker.ProcessedFolder} {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return broker, nil
+}
+
+// SendCeleryMessage writes CeleryMessage into FolderOut
+func (b *FilesystemBroker) SendCeleryMessage(message *CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	id := uuid.Must(uuid.NewV4()).String()
+	fileName := fmt.Sprintf("%d_%s.%s.msg", time.Now().UnixNano()/int64(time.Millisecond), id, b.QueueName)
+	// message is written to hidden file first so that it is never read partially
+	return writeFileAtomic(filepath.Join(b.FolderOut, fileName), jsonBytes)
+}
+
+// GetCeleryMessage claims oldest celery message from FolderIn
+func (b *FilesystemBroker) GetCeleryMessage() (*CeleryMessage, error) {
+	entries, err := ioutil.ReadDir(b.FolderIn)
+	if err != nil {
+		return nil, err
+	}
+	suffix := "." + b.QueueName + ".msg"
+	// entries are sorted by file name, which starts with timestamp
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+		claimed := filepath.Join(b.ProcessedFolder, entry.Name())
+		if err := os.Rename(filepath.Join(b.FolderIn, entry.Name()), claimed); err != nil {
+			// message was claimed by other worker
+			continue
+		}
+		jsonBytes, err := ioutil.ReadFile(claimed)
+		if err != nil {
+			return nil, err
+		}
+		if !b.StoreProcessed {
+			os.Remove(claimed)
+		}
+		var message CeleryMessage
+		if err := json.Unmarshal(jsonBytes, &message); err != nil {
+			return nil, err
+		}
+		return &message, nil
+	}
+	return nil, fmt.Errorf("filesystem queue %s is empty", b.QueueName)
+}
+
+// GetTaskMessage retrieves task message from FolderIn
+func (b *FilesystemBroker) GetTaskMessage() (*TaskMessage, error) {
+	celeryMessage, err := b.GetCeleryMessage()
+	if err != nil {
+		return nil, err
+	}
+	return b.decodeTaskMessage(celeryMessage), nil
+}
+
+// writeFileAtomic writes data into temporary hidden file in the same directory
+// and renames it to fileName, so that readers never see partially written file
+func writeFileAtomic(fileName string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(fileName), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), fileName); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	return nil
+}
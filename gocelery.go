@@ -6,15 +6,24 @@ package gocelery
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
 // CeleryClient provides API for sending celery tasks
 type CeleryClient struct {
-	broker  CeleryBroker
-	backend CeleryBackend
-	worker  *CeleryWorker
+	broker     CeleryBroker
+	backend    CeleryBackend
+	worker     *CeleryWorker
+	serializer Serializer
+	compressor Compressor
+
+	encryption          *EncryptedBackend
+	encryptedSerializer *EncryptedSerializer
+
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
 }
 
 // CeleryBroker is interface for celery broker database
@@ -23,24 +32,180 @@ type CeleryBroker interface {
 	GetTaskMessage() (*TaskMessage, error) // must be non-blocking
 }
 
+// CeleryAcksLateBroker is optional interface for brokers that
+// acknowledge task messages only after task execution is finished.
+// Unacknowledged messages are redelivered when worker crashes.
+type CeleryAcksLateBroker interface {
+	CeleryBroker
+	AckTaskMessage(*TaskMessage) error
+}
+
+// CeleryBlockingBroker is optional interface for brokers that can wait
+// for task messages to arrive instead of being polled by workers.
+type CeleryBlockingBroker interface {
+	CeleryBroker
+	GetTaskMessageWithContext(context.Context) (*TaskMessage, error) // blocks until message arrives or context is done
+}
+
 // CeleryBackend is interface for celery backend database
 type CeleryBackend interface {
 	GetResult(string) (*ResultMessage, error) // must be non-blocking
 	SetResult(taskID string, result *ResultMessage) error
 }
 
+// CeleryForgettingBackend is optional interface for backends that
+// remove stored results like celery AsyncResult.forget().
+type CeleryForgettingBackend interface {
+	CeleryBackend
+	ForgetResult(taskID string) error
+}
+
+// CeleryBatchBackend is optional interface for backends that retrieve
+// results of multiple tasks at once, which is used by ResultSet.
+type CeleryBatchBackend interface {
+	CeleryBackend
+	GetResults(taskIDs []string) ([]*ResultMessage, error) // results of unavailable tasks are nil
+}
+
+// CeleryGroupBackend is optional interface for backends that store
+// ids of tasks belonging to group like celery GroupResult.save().
+type CeleryGroupBackend interface {
+	CeleryBackend
+	SaveGroup(groupID string, taskIDs []string) error
+	GetGroup(groupID string) ([]string, error)
+	DeleteGroup(groupID string) error
+}
+
+// ErrResultNotAvailable is returned by backends for results which are not stored yet
+var ErrResultNotAvailable = errors.New("result not available")
+
 // NewCeleryClient creates new celery client
 func NewCeleryClient(broker CeleryBroker, backend CeleryBackend, numWorkers int) (*CeleryClient, error) {
 	return &CeleryClient{
-		broker,
-		backend,
-		NewCeleryWorker(broker, backend, numWorkers),
+		broker:     broker,
+		backend:    backend,
+		worker:     NewCeleryWorker(broker, backend, numWorkers),
+		serializer: jsonSerializer{},
 	}, nil
 }
 
-// Register task
-func (cc *CeleryClient) Register(name string, task interface{}) {
-	cc.worker.Register(name, task)
+// SetSerializer sets serializer of sent task messages by registered name
+// such as json, msgpack and yaml or by content type
+func (cc *CeleryClient) SetSerializer(name string) error {
+	serializer, err := GetSerializer(name)
+	if err != nil {
+		return err
+	}
+	cc.serializer = serializer
+	cc.setEncryptedSerializer()
+	return nil
+}
+
+// SetupSecurity enables message signing like celery setup_security.
+// Sent task messages are signed with private key of certificate using auth serializer
+// and workers accept only signed messages verified against certificate store,
+// which is glob pattern or directory of trusted certificates.
+// Auth serializer is set up only for broker of client instead of being registered globally.
+func (cc *CeleryClient) SetupSecurity(keyFile, certFile, certStore string) error {
+	broker, ok := cc.broker.(serializingBroker)
+	if !ok {
+		return fmt.Errorf("broker %T does not support message signing", cc.broker)
+	}
+	serializer, err := NewAuthSerializer(keyFile, certFile, certStore)
+	if err != nil {
+		return err
+	}
+	broker.setSerializer(serializer)
+	cc.serializer = serializer
+	cc.setEncryptedSerializer()
+	cc.worker.setAcceptContentTypes(serializer.ContentType())
+	return nil
+}
+
+// SetEncryption encrypts task messages and results with AES-GCM keys of given provider.
+// Task messages are encrypted after serialization with current serializer and workers
+// accept encrypted messages in addition to accepted content. Results and tracebacks
+// are encrypted in backend while task state stays readable.
+// Encrypted serializer is set up only for broker of client instead of being registered globally.
+// Encryption stays applied on top of serializer set by later SetSerializer and SetupSecurity calls
+// and calling it again replaces keys.
+func (cc *CeleryClient) SetEncryption(keys KeyProvider) error {
+	if _, ok := cc.broker.(serializingBroker); !ok {
+		return fmt.Errorf("broker %T does not support message encryption", cc.broker)
+	}
+	backend := cc.backend
+	if cc.encryption != nil {
+		backend = cc.encryption.Backend
+	}
+	cc.encryption = NewEncryptedBackend(backend, keys)
+	cc.backend = cc.encryption
+	cc.setEncryptedSerializer()
+	cc.worker.setEncryption(cc.encryption)
+	return nil
+}
+
+// setEncryptedSerializer sets up encryption of task messages serialized by current serializer
+// and decryption of them in broker when encryption is enabled
+func (cc *CeleryClient) setEncryptedSerializer() {
+	if cc.encryption == nil {
+		return
+	}
+	cc.encryptedSerializer = &EncryptedSerializer{
+		Serializer: cc.serializer,
+		Codec:      cc.encryption.Codec,
+	}
+	cc.broker.(serializingBroker).setSerializer(cc.encryptedSerializer)
+}
+
+// messageSerializer returns serializer of sent task messages
+func (cc *CeleryClient) messageSerializer() Serializer {
+	if cc.encryptedSerializer != nil {
+		return cc.encryptedSerializer
+	}
+	return cc.serializer
+}
+
+// SetCompression sets compression of sent task messages by registered name
+// such as zlib, gzip, bzip2 and zstd or by content type. Empty name disables compression.
+// Workers decompress task messages regardless of this setting.
+func (cc *CeleryClient) SetCompression(name string) error {
+	if name == "" {
+		cc.compressor = nil
+		return nil
+	}
+	compressor, err := GetCompressor(name)
+	if err != nil {
+		return err
+	}
+	cc.compressor = compressor
+	return nil
+}
+
+// SetAcceptContent sets serializers of task messages accepted by workers
+func (cc *CeleryClient) SetAcceptContent(names ...string) error {
+	return cc.worker.SetAcceptContent(names...)
+}
+
+// SetTrackStarted enables reporting STARTED state of tasks run by workers of client
+func (cc *CeleryClient) SetTrackStarted(enabled bool) {
+	cc.worker.SetTrackStarted(enabled)
+}
+
+// SetTrackReceived enables reporting RECEIVED state of task messages fetched by workers of client
+func (cc *CeleryClient) SetTrackReceived(enabled bool) {
+	cc.worker.SetTrackReceived(enabled)
+}
+
+// SetResultPolling sets how often results returned by Delay poll backend while waiting.
+// Interval doubles after each poll up to maxInterval, which disables backoff if it is not greater than interval.
+func (cc *CeleryClient) SetResultPolling(interval, maxInterval time.Duration) {
+	cc.pollInterval = interval
+	cc.maxPollInterval = maxInterval
+}
+
+// Register task with given options
+func (cc *CeleryClient) Register(name string, task interface{}, options ...TaskOption) {
+	cc.worker.Register(name, task, options...)
 }
 
 // StartWorkerWithContext starts celery workers with given parent context
@@ -79,20 +244,29 @@ func (cc *CeleryClient) DelayKwargs(task string, args map[string]interface{}) (*
 
 func (cc *CeleryClient) delay(task *TaskMessage) (*AsyncResult, error) {
 	defer releaseTaskMessage(task)
-	encodedMessage, err := task.Encode()
+	serializer := cc.messageSerializer()
+	encodedMessage, err := task.encode(serializer, cc.compressor)
 	if err != nil {
 		return nil, err
 	}
 	celeryMessage := getCeleryMessage(encodedMessage)
 	defer releaseCeleryMessage(celeryMessage)
+	celeryMessage.taskMessage = task
+	celeryMessage.ContentType = serializer.ContentType()
+	celeryMessage.ContentEncoding = serializer.ContentEncoding()
+	if cc.compressor != nil {
+		celeryMessage.Headers = map[string]interface{}{"compression": cc.compressor.ContentType()}
+	}
 	err = cc.broker.SendCeleryMessage(celeryMessage)
 	if err != nil {
 		return nil, err
 	}
-	return &AsyncResult{
-		TaskID:  task.ID,
-		backend: cc.backend,
-	}, nil
+	asyncResult := NewAsyncResult(task.ID, cc.backend)
+	if cc.pollInterval > 0 {
+		asyncResult.PollInterval = cc.pollInterval
+		asyncResult.MaxPollInterval = cc.maxPollInterval
+	}
+	return asyncResult, nil
 }
 
 // CeleryTask is an interface that represents actual task
@@ -113,56 +287,97 @@ type AsyncResult struct {
 	TaskID  string
 	backend CeleryBackend
 	result  *ResultMessage
+
+	// PollInterval is initial interval between polls of backend while waiting for result
+	PollInterval time.Duration
+	// MaxPollInterval limits interval doubled after each poll, no backoff is used if it is not greater than PollInterval
+	MaxPollInterval time.Duration
+}
+
+// NewAsyncResult creates AsyncResult of task with given id stored in backend
+func NewAsyncResult(taskID string, backend CeleryBackend) *AsyncResult {
+	return &AsyncResult{
+		TaskID:       taskID,
+		backend:      backend,
+		PollInterval: defaultPollInterval,
+	}
 }
 
 // Get gets actual result from backend
-// It blocks for period of time set by timeout and returns error if unavailable
+// It blocks for period of time set by timeout and returns error if unavailable.
+// It returns ResultError as soon as task fails or is revoked.
 func (ar *AsyncResult) Get(timeout time.Duration) (interface{}, error) {
-	ticker := time.NewTicker(50 * time.Millisecond)
-	timeoutChan := time.After(timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	val, err := ar.GetContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%v timeout getting result for %s", timeout, ar.TaskID)
+	}
+	return val, err
+}
+
+// GetContext gets actual result from backend polling it until result is available or context is done.
+// It returns ResultError as soon as task fails or is revoked and errors of backend right away.
+// Context is checked only between polls, so single call to backend is not interrupted when context is done.
+func (ar *AsyncResult) GetContext(ctx context.Context) (interface{}, error) {
+	p := newPoller(ar.PollInterval, ar.MaxPollInterval)
 	for {
-		select {
-		case <-timeoutChan:
-			err := fmt.Errorf("%v timeout getting result for %s", timeout, ar.TaskID)
+		val, err := ar.AsyncGet()
+		if !errors.Is(err, ErrResultNotAvailable) {
+			return val, err
+		}
+		if err := p.wait(ctx); err != nil {
 			return nil, err
-		case <-ticker.C:
-			val, err := ar.AsyncGet()
-			if err != nil {
-				continue
-			}
-			return val, nil
 		}
 	}
 }
 
-// AsyncGet gets actual result from backend and returns nil if not available
+// AsyncGet gets actual result from backend and returns error if not available.
+// It returns ResultError if task failed or was revoked.
 func (ar *AsyncResult) AsyncGet() (interface{}, error) {
-	if ar.result != nil {
-		return ar.result.Result, nil
-	}
-	val, err := ar.backend.GetResult(ar.TaskID)
+	meta, err := ar.getMeta()
 	if err != nil {
 		return nil, err
 	}
-	if val == nil {
-		return nil, err
+	if meta == nil || !isReadyState(meta.Status) {
+		return nil, ErrResultNotAvailable
+	}
+	return resultValue(meta)
+}
+
+// GetInto gets result like Get and decodes it into value pointed to by v.
+// Result is converted to type of v like task arguments, e.g. into structs by json tags.
+func (ar *AsyncResult) GetInto(timeout time.Duration, v interface{}) error {
+	val, err := ar.Get(timeout)
+	if err != nil {
+		return err
 	}
-	if val.Status != "SUCCESS" {
-		return nil, fmt.Errorf("error response status %v", val)
+	return decodeResultValue(val, v)
+}
+
+// GetIntoContext gets result like GetContext and decodes it into value pointed to by v
+func (ar *AsyncResult) GetIntoContext(ctx context.Context, v interface{}) error {
+	val, err := ar.GetContext(ctx)
+	if err != nil {
+		return err
 	}
-	ar.result = val
-	return val.Result, nil
+	return decodeResultValue(val, v)
 }
 
-// Ready checks if actual result is ready
-func (ar *AsyncResult) Ready() (bool, error) {
-	if ar.result != nil {
-		return true, nil
+// AsyncGetInto gets result like AsyncGet and decodes it into value pointed to by v
+func (ar *AsyncResult) AsyncGetInto(v interface{}) error {
+	val, err := ar.AsyncGet()
+	if err != nil {
+		return err
 	}
-	val, err := ar.backend.GetResult(ar.TaskID)
+	return decodeResultValue(val, v)
+}
+
+// Ready checks if task is finished, i.e. it succeeded, failed or was revoked
+func (ar *AsyncResult) Ready() (bool, error) {
+	state, err := ar.State()
 	if err != nil {
 		return false, err
 	}
-	ar.result = val
-	return (val != nil), nil
+	return isReadyState(state), nil
 }
@@ -5,6 +5,8 @@
 package gocelery
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -31,6 +33,7 @@ var (
 	redisBrokerWithConn  = NewRedisBroker(redisPool)
 	redisBackend         = NewRedisCeleryBackend("redis://")
 	redisBackendWithConn = NewRedisBackend(redisPool)
+	redisStreamsBroker   = NewRedisStreamsBroker(redisPool)
 	amqpBroker           = NewAMQPCeleryBroker("amqp://")
 	amqpBackend          = NewAMQPCeleryBackend("amqp://")
 )
@@ -1445,4 +1448,314 @@ func convertInterfaceToStringMap(i interface{}) map[string]string {
 		stringMap[i] = fmt.Sprint(v)
 	}
 	return stringMap
-}
\ No newline at end of file
+}
+
+// TestAsyncResultGetInto tests decoding results into caller supplied types
+func TestAsyncResultGetInto(t *testing.T) {
+	backend := NewMemoryBackend()
+	cli, _ := NewCeleryClient(NewMemoryBroker(), backend, 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	cli.Register(taskName, func(x int) encodedPoint {
+		return encodedPoint{X: x, Y: x * 2}
+	})
+	cli.StartWorker()
+	defer cli.StopWorker()
+
+	asyncResult, err := cli.Delay(taskName, 3)
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	var point encodedPoint
+	if err := asyncResult.GetInto(TIMEOUT, &point); err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if point.X != 3 || point.Y != 6 {
+		t.Errorf("received unexpected result %+v", point)
+	}
+	var mistyped []string
+	if err := asyncResult.AsyncGetInto(&mistyped); err == nil {
+		t.Errorf("expected result not to be decoded as %T", mistyped)
+	}
+	if err := asyncResult.AsyncGetInto(point); err == nil {
+		t.Errorf("expected result not to be decoded into non-pointer")
+	}
+
+	// values tagged by kombu json encoder of python workers are decoded from their string values
+	taskID := uuid.Must(uuid.NewV4()).String()
+	resultMessage := getResultMessage(map[string]interface{}{
+		"at": map[string]interface{}{"__type__": "datetime", "__value__": "2021-03-04T05:06:07.123456"},
+		"id": map[string]interface{}{"__type__": "uuid", "__value__": "0f8fad5b-d9cb-469f-a165-70867728950e"},
+	})
+	err = backend.SetResult(taskID, resultMessage)
+	releaseResultMessage(resultMessage)
+	if err != nil {
+		t.Fatalf("failed to set result: %v", err)
+	}
+	pythonResult := &AsyncResult{TaskID: taskID, backend: backend}
+	if err := pythonResult.AsyncGetInto(&point); err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if !point.At.Equal(time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)) || point.ID.String() != "0f8fad5b-d9cb-469f-a165-70867728950e" {
+		t.Errorf("received unexpected result %+v", point)
+	}
+}
+
+// nonForgettingBackend is backend not supporting forgetting results
+type nonForgettingBackend struct {
+	CeleryBackend
+}
+
+// TestAsyncResultState tests inspecting states and metadata of task results
+func TestAsyncResultState(t *testing.T) {
+	backend := NewMemoryBackend()
+	cli, _ := NewCeleryClient(NewMemoryBroker(), backend, 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	cli.Register(taskName, func(fail bool) (int, error) {
+		if fail {
+			return 0, fmt.Errorf("failed on purpose")
+		}
+		return 1, nil
+	})
+
+	asyncResult, err := cli.Delay(taskName, true)
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	if state, err := asyncResult.State(); err != nil || state != StatePending {
+		t.Errorf("expected pending task but received state %s: %v", state, err)
+	}
+	if ready, err := asyncResult.Ready(); err != nil || ready {
+		t.Errorf("expected pending task not to be ready: %v", err)
+	}
+
+	cli.StartWorker()
+	defer cli.StopWorker()
+	start := time.Now()
+	_, err = asyncResult.Get(5 * time.Second)
+	var resultErr *ResultError
+	if !errors.As(err, &resultErr) || resultErr.State != StateFailure || resultErr.Message != "failed on purpose" {
+		t.Fatalf("expected failure of task but received %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("expected failure to be returned without waiting for timeout")
+	}
+	if failed, err := asyncResult.Failed(); err != nil || !failed {
+		t.Errorf("expected task to fail: %v", err)
+	}
+	if successful, err := asyncResult.Successful(); err != nil || successful {
+		t.Errorf("expected task not to succeed: %v", err)
+	}
+	if ready, err := asyncResult.Ready(); err != nil || !ready {
+		t.Errorf("expected failed task to be ready: %v", err)
+	}
+	if traceback, err := asyncResult.Traceback(); err != nil || traceback != "failed on purpose" {
+		t.Errorf("received unexpected traceback %q: %v", traceback, err)
+	}
+	if info, err := asyncResult.Info(); err != nil || info.(map[string]interface{})["exc_type"] != "Exception" {
+		t.Errorf("received unexpected info %v: %v", info, err)
+	}
+	if dateDone, err := asyncResult.DateDone(); err != nil || time.Since(dateDone) > time.Minute {
+		t.Errorf("received unexpected date done %v: %v", dateDone, err)
+	}
+
+	// running tasks are not ready and expose their metadata
+	runningResult := &AsyncResult{TaskID: uuid.Must(uuid.NewV4()).String(), backend: backend}
+	resultMessage := getResultMessage(map[string]interface{}{"progress": 0.5})
+	resultMessage.Status = StateStarted
+	resultMessage.Children = []interface{}{"child"}
+	err = backend.SetResult(runningResult.TaskID, resultMessage)
+	releaseResultMessage(resultMessage)
+	if err != nil {
+		t.Fatalf("failed to set result: %v", err)
+	}
+	if state, err := runningResult.State(); err != nil || state != StateStarted {
+		t.Errorf("expected started task but received state %s: %v", state, err)
+	}
+	if _, err := runningResult.AsyncGet(); err != ErrResultNotAvailable {
+		t.Errorf("expected result of started task not to be available but received %v", err)
+	}
+	if info, err := runningResult.Info(); err != nil || info.(map[string]interface{})["progress"] != 0.5 {
+		t.Errorf("received unexpected info %v: %v", info, err)
+	}
+	if children, err := runningResult.Children(); err != nil || len(children) != 1 {
+		t.Errorf("received unexpected children %v: %v", children, err)
+	}
+	if dateDone, err := runningResult.DateDone(); err != nil || !dateDone.IsZero() {
+		t.Errorf("expected running task not to be done but received %v: %v", dateDone, err)
+	}
+
+	// forgotten results are pending again
+	if err := asyncResult.Forget(); err != nil {
+		t.Fatalf("failed to forget result: %v", err)
+	}
+	if state, err := asyncResult.State(); err != nil || state != StatePending {
+		t.Errorf("expected forgotten task to be pending but received state %s: %v", state, err)
+	}
+	unsupported := &AsyncResult{TaskID: runningResult.TaskID, backend: nonForgettingBackend{backend}}
+	if err := unsupported.Forget(); err == nil {
+		t.Errorf("expected backend not supporting forgetting results to fail")
+	}
+}
+
+// TestAsyncResultGetContext tests waiting for result until context is done
+func TestAsyncResultGetContext(t *testing.T) {
+	backend := NewMemoryBackend()
+	asyncResult := NewAsyncResult(uuid.Must(uuid.NewV4()).String(), backend)
+	asyncResult.PollInterval = 10 * time.Millisecond
+	asyncResult.MaxPollInterval = 40 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := asyncResult.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline to be exceeded but received %v", err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := asyncResult.GetContext(canceled); err != context.Canceled {
+		t.Errorf("expected context to be canceled but received %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		resultMessage := getResultMessage("done")
+		backend.SetResult(asyncResult.TaskID, resultMessage)
+		releaseResultMessage(resultMessage)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	val, err := asyncResult.GetContext(ctx)
+	if err != nil || val != "done" {
+		t.Errorf("received unexpected result %v: %v", val, err)
+	}
+}
+
+// failingBackend is backend failing to retrieve results
+type failingBackend struct {
+	CeleryBackend
+}
+
+func (b *failingBackend) GetResult(taskID string) (*ResultMessage, error) {
+	return nil, errBackendFailure
+}
+
+var errBackendFailure = errors.New("backend failure")
+
+// TestAsyncResultBackendFailure tests that errors of backends are returned without polling
+func TestAsyncResultBackendFailure(t *testing.T) {
+	backend := &failingBackend{NewMemoryBackend()}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	asyncResult := NewAsyncResult(uuid.Must(uuid.NewV4()).String(), backend)
+	if _, err := asyncResult.GetContext(ctx); err != errBackendFailure {
+		t.Errorf("expected backend failure but received %v", err)
+	}
+	resultSet := NewResultSet(asyncResult, NewAsyncResult(uuid.Must(uuid.NewV4()).String(), backend))
+	if _, err := resultSet.Join(ctx); err != errBackendFailure {
+		t.Errorf("expected backend failure from Join but received %v", err)
+	}
+	var received []CompletedResult
+	for result := range resultSet.AsCompleted(ctx) {
+		received = append(received, result)
+	}
+	if len(received) != 1 || received[0].Index != -1 || received[0].Err != errBackendFailure {
+		t.Errorf("expected backend failure from AsCompleted but received %+v", received)
+	}
+}
+
+// TestResultSet tests waiting for results of multiple tasks
+func TestResultSet(t *testing.T) {
+	testCases := []struct {
+		name    string
+		backend CeleryGroupBackend
+	}{
+		{
+			name:    "result set with memory backend",
+			backend: NewMemoryBackend(),
+		},
+		{
+			name:    "result set with redis backend",
+			backend: redisBackendWithConn,
+		},
+	}
+	for _, tc := range testCases {
+		var results []*AsyncResult
+		for i := 0; i < 3; i++ {
+			asyncResult := NewAsyncResult(uuid.Must(uuid.NewV4()).String(), tc.backend)
+			results = append(results, asyncResult)
+		}
+		groupResult := NewGroupResult(uuid.Must(uuid.NewV4()).String(), results...)
+		groupResult.PollInterval = 10 * time.Millisecond
+		if ready, err := groupResult.Ready(); err != nil || ready {
+			t.Errorf("test '%s': expected pending tasks not to be ready: %v", tc.name, err)
+		}
+
+		// results are sent as they complete
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		completed := groupResult.AsCompleted(ctx)
+		for _, i := range []int{2, 0, 1} {
+			resultMessage := getResultMessage(float64(i))
+			err := tc.backend.SetResult(results[i].TaskID, resultMessage)
+			releaseResultMessage(resultMessage)
+			if err != nil {
+				t.Fatalf("test '%s': failed to set result: %v", tc.name, err)
+			}
+			result, ok := <-completed
+			if !ok || result.Index != i || result.TaskID != results[i].TaskID || result.Result != float64(i) || result.Err != nil {
+				t.Errorf("test '%s': received unexpected completed result %+v", tc.name, result)
+			}
+		}
+		if _, ok := <-completed; ok {
+			t.Errorf("test '%s': expected channel to be closed", tc.name)
+		}
+		values, err := groupResult.Join(ctx)
+		cancel()
+		if err != nil || !reflect.DeepEqual(values, []interface{}{0.0, 1.0, 2.0}) {
+			t.Errorf("test '%s': received unexpected results %v: %v", tc.name, values, err)
+		}
+		if completedCount, err := groupResult.Completed(); err != nil || completedCount != 3 {
+			t.Errorf("test '%s': expected 3 completed tasks but received %d: %v", tc.name, completedCount, err)
+		}
+
+		// groups are restored from backend
+		if err := groupResult.Save(tc.backend); err != nil {
+			t.Fatalf("test '%s': failed to save group: %v", tc.name, err)
+		}
+		restored, err := RestoreGroupResult(tc.backend, groupResult.ID)
+		if err != nil || !reflect.DeepEqual(restored.TaskIDs(), groupResult.TaskIDs()) {
+			t.Fatalf("test '%s': failed to restore group: %v", tc.name, err)
+		}
+
+		// failures are returned without waiting for other tasks
+		resultMessage := getFailureResultMessage(fmt.Errorf("failed on purpose"))
+		err = tc.backend.SetResult(restored.Results[1].TaskID, resultMessage)
+		releaseResultMessage(resultMessage)
+		if err != nil {
+			t.Fatalf("test '%s': failed to set result: %v", tc.name, err)
+		}
+		restored.Results = append(restored.Results, NewAsyncResult(uuid.Must(uuid.NewV4()).String(), tc.backend))
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = restored.Join(ctx)
+		cancel()
+		var resultErr *ResultError
+		if !errors.As(err, &resultErr) || resultErr.TaskID != restored.Results[1].TaskID {
+			t.Errorf("test '%s': expected failure of task but received %v", tc.name, err)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		completed = restored.AsCompleted(ctx)
+		count := 0
+		for range completed {
+			count++
+		}
+		cancel()
+		if count != 3 {
+			t.Errorf("test '%s': expected 3 completed results before context is done but received %d", tc.name, count)
+		}
+
+		if err := restored.Delete(tc.backend); err != nil {
+			t.Errorf("test '%s': failed to delete group: %v", tc.name, err)
+		}
+		if _, err := RestoreGroupResult(tc.backend, groupResult.ID); err == nil {
+			t.Errorf("test '%s': expected deleted group not to be available", tc.name)
+		}
+	}
+}
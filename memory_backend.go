@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// MemoryCeleryBackend is in-process celery backend.
+// It is meant for tests and for running client and worker within single process.
+type MemoryCeleryBackend struct {
+	lock    sync.RWMutex
+	results map[string][]byte
+	groups  map[string][]string
+}
+
+// NewMemoryBackend creates new MemoryCeleryBackend
+func NewMemoryBackend() *MemoryCeleryBackend {
+	return &MemoryCeleryBackend{
+		results: map[string][]byte{},
+		groups:  map[string][]string{},
+	}
+}
+
+// GetResult retrieves result from memory
+func (b *MemoryCeleryBackend) GetResult(taskID string) (*ResultMessage, error) {
+	b.lock.RLock()
+	resBytes, ok := b.results[taskID]
+	b.lock.RUnlock()
+	if !ok {
+		return nil, ErrResultNotAvailable
+	}
+	var resultMessage ResultMessage
+	if err := json.Unmarshal(resBytes, &resultMessage); err != nil {
+		return nil, err
+	}
+	return &resultMessage, nil
+}
+
+// GetResults retrieves results of multiple tasks from memory
+func (b *MemoryCeleryBackend) GetResults(taskIDs []string) ([]*ResultMessage, error) {
+	results := make([]*ResultMessage, len(taskIDs))
+	for i, taskID := range taskIDs {
+		result, err := b.GetResult(taskID)
+		if err == ErrResultNotAvailable {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// ForgetResult removes result from memory
+func (b *MemoryCeleryBackend) ForgetResult(taskID string) error {
+	b.lock.Lock()
+	delete(b.results, taskID)
+	b.lock.Unlock()
+	return nil
+}
+
+// SetResult stores result in memory
+func (b *MemoryCeleryBackend) SetResult(taskID string, result *ResultMessage) error {
+	// result is copied as worker releases it after storing
+	resBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.results[taskID] = resBytes
+	b.lock.Unlock()
+	return nil
+}
+
+// SaveGroup stores ids of tasks belonging to group in memory
+func (b *MemoryCeleryBackend) SaveGroup(groupID string, taskIDs []string) error {
+	b.lock.Lock()
+	b.groups[groupID] = append([]string{}, taskIDs...)
+	b.lock.Unlock()
+	return nil
+}
+
+// GetGroup retrieves ids of tasks belonging to group from memory
+func (b *MemoryCeleryBackend) GetGroup(groupID string) ([]string, error) {
+	b.lock.RLock()
+	taskIDs, ok := b.groups[groupID]
+	b.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("group %s not available", groupID)
+	}
+	return append([]string{}, taskIDs...), nil
+}
+
+// DeleteGroup removes group from memory
+func (b *MemoryCeleryBackend) DeleteGroup(groupID string) error {
+	b.lock.Lock()
+	delete(b.groups, groupID)
+	b.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// MemoryCeleryBroker is in-process celery broker.
+// It is meant for tests and for running client and worker within single process.
+type MemoryCeleryBroker struct {
+	lock     sync.Mutex
+	messages [][]byte
+	brokerSerializers
+}
+
+// NewMemoryBroker creates new MemoryCeleryBroker
+func NewMemoryBroker() *MemoryCeleryBroker {
+	return &MemoryCeleryBroker{}
+}
+
+// SendCeleryMessage appends CeleryMessage to in-memory queue
+func (b *MemoryCeleryBroker) SendCeleryMessage(message *CeleryMessage) error {
+	// message is copied as client releases it after sending
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.messages = append(b.messages, jsonBytes)
+	b.lock.Unlock()
+	return nil
+}
+
+// GetCeleryMessage retrieves oldest celery message from in-memory queue
+func (b *MemoryCeleryBroker) GetCeleryMessage() (*CeleryMessage, error) {
+	b.lock.Lock()
+	if len(b.messages) == 0 {
+		b.lock.Unlock()
+		return nil, fmt.Errorf("memory queue is empty")
+	}
+	jsonBytes := b.messages[0]
+	b.messages = b.messages[1:]
+	b.lock.Unlock()
+	var message CeleryMessage
+	if err := json.Unmarshal(jsonBytes, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetTaskMessage retrieves task message from in-memory queue
+func (b *MemoryCeleryBroker) GetTaskMessage() (*TaskMessage, error) {
+	celeryMessage, err := b.GetCeleryMessage()
+	if err != nil {
+		return nil, err
+	}
+	return b.decodeTaskMessage(celeryMessage), nil
+}
+
+// Len returns number of messages waiting in in-memory queue
+func (b *MemoryCeleryBroker) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.messages)
+}
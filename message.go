@@ -6,9 +6,10 @@ package gocelery
 
 import (
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"log"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,11 +23,17 @@ type CeleryMessage struct {
 	ContentType     string                 `json:"content-type"`
 	Properties      CeleryProperties       `json:"properties"`
 	ContentEncoding string                 `json:"content-encoding"`
+
+	// taskMessage is task message body was encoded from while client sends it
+	taskMessage *TaskMessage
 }
 
 func (cm *CeleryMessage) reset() {
 	cm.Headers = nil
+	cm.taskMessage = nil
 	cm.Body = ""
+	cm.ContentType = "application/json"
+	cm.ContentEncoding = "utf-8"
 	cm.Properties.CorrelationID = uuid.Must(uuid.NewV4()).String()
 	cm.Properties.ReplyTo = uuid.Must(uuid.NewV4()).String()
 	cm.Properties.DeliveryTag = uuid.Must(uuid.NewV4()).String()
@@ -84,9 +91,20 @@ type CeleryDeliveryInfo struct {
 }
 
 // GetTaskMessage retrieve and decode task messages from broker
+// using serializer registered for content type of message
 func (cm *CeleryMessage) GetTaskMessage() *TaskMessage {
-	// ensure content-type is 'application/json'
-	if cm.ContentType != "application/json" {
+	return cm.decodeTaskMessage(GetSerializer)
+}
+
+// decodeTaskMessage decodes task message using serializer of content type returned by getSerializer
+func (cm *CeleryMessage) decodeTaskMessage(getSerializer func(string) (Serializer, error)) *TaskMessage {
+	// ensure content-type has registered serializer
+	serializer, err := getSerializer(cm.ContentType)
+	if err != nil && cm.ContentType == EncryptedContentType {
+		log.Println("unable to decrypt encrypted task message: encryption keys are not configured")
+		return nil
+	}
+	if err != nil {
 		log.Println("unsupported content type " + cm.ContentType)
 		return nil
 	}
@@ -95,15 +113,23 @@ func (cm *CeleryMessage) GetTaskMessage() *TaskMessage {
 		log.Println("unsupported body encoding " + cm.Properties.BodyEncoding)
 		return nil
 	}
-	// ensure content encoding is utf-8
-	if cm.ContentEncoding != "utf-8" {
+	// ensure content encoding matches serializer
+	if !strings.EqualFold(cm.ContentEncoding, serializer.ContentEncoding()) {
 		log.Println("unsupported encoding " + cm.ContentEncoding)
 		return nil
 	}
-	// decode body
-	taskMessage, err := DecodeTaskMessage(cm.Body)
+	// decode body decompressing it if compression header is set
+	body, err := base64.StdEncoding.DecodeString(cm.Body)
+	if err == nil {
+		body, err = decompressHeader(body, cm.Headers["compression"])
+	}
+	if err != nil {
+		log.Printf("failed to decode task message body: %v", err)
+		return nil
+	}
+	taskMessage, err := decodeTaskMessageBody(body, serializer)
 	if err != nil {
-		log.Println("failed to decode task message")
+		log.Printf("failed to decode task message: %v", err)
 		return nil
 	}
 	return taskMessage
@@ -118,6 +144,9 @@ type TaskMessage struct {
 	Retries int                    `json:"retries"`
 	ETA     *string                `json:"eta"`
 	Expires *time.Time             `json:"expires"`
+
+	// contentType is content type task message was received with
+	contentType string
 }
 
 func (tm *TaskMessage) reset() {
@@ -125,6 +154,7 @@ func (tm *TaskMessage) reset() {
 	tm.Task = ""
 	tm.Args = nil
 	tm.Kwargs = nil
+	tm.contentType = ""
 }
 
 var taskMessagePool = sync.Pool{
@@ -155,28 +185,55 @@ func releaseTaskMessage(v *TaskMessage) {
 
 // DecodeTaskMessage decodes base64 encrypted body and return TaskMessage object
 func DecodeTaskMessage(encodedBody string) (*TaskMessage, error) {
+	return DecodeTaskMessageWithSerializer(encodedBody, jsonSerializer{})
+}
+
+// DecodeTaskMessageWithSerializer decodes base64 encoded body serialized by given serializer
+func DecodeTaskMessageWithSerializer(encodedBody string, serializer Serializer) (*TaskMessage, error) {
 	body, err := base64.StdEncoding.DecodeString(encodedBody)
 	if err != nil {
 		return nil, err
 	}
+	return decodeTaskMessageBody(body, serializer)
+}
+
+// decodeTaskMessageBody decodes serialized task message body
+func decodeTaskMessageBody(body []byte, serializer Serializer) (*TaskMessage, error) {
 	message := taskMessagePool.Get().(*TaskMessage)
-	err = json.Unmarshal(body, message)
+	err := serializer.Unmarshal(body, message)
 	if err != nil {
 		return nil, err
 	}
+	message.contentType = serializer.ContentType()
 	return message, nil
 }
 
 // Encode returns base64 json encoded string
 func (tm *TaskMessage) Encode() (string, error) {
+	return tm.EncodeWithSerializer(jsonSerializer{})
+}
+
+// EncodeWithSerializer returns base64 encoded string serialized by given serializer
+func (tm *TaskMessage) EncodeWithSerializer(serializer Serializer) (string, error) {
+	return tm.encode(serializer, nil)
+}
+
+// encode returns base64 encoded string serialized by given serializer
+// and compressed by given compressor unless it is nil
+func (tm *TaskMessage) encode(serializer Serializer, compressor Compressor) (string, error) {
 	if tm.Args == nil {
 		tm.Args = make([]interface{}, 0)
 	}
-	jsonData, err := json.Marshal(tm)
+	data, err := serializer.Marshal(tm)
 	if err != nil {
 		return "", err
 	}
-	encodedData := base64.StdEncoding.EncodeToString(jsonData)
+	if compressor != nil {
+		if data, err = compressor.Compress(data); err != nil {
+			return "", err
+		}
+	}
+	encodedData := base64.StdEncoding.EncodeToString(data)
 	return encodedData, err
 }
 
@@ -187,10 +244,15 @@ type ResultMessage struct {
 	Traceback interface{}   `json:"traceback"`
 	Result    interface{}   `json:"result"`
 	Children  []interface{} `json:"children"`
+	DateDone  string        `json:"date_done,omitempty"`
 }
 
 func (rm *ResultMessage) reset() {
+	rm.ID = ""
+	rm.Status = "SUCCESS"
+	rm.Traceback = nil
 	rm.Result = nil
+	rm.DateDone = ""
 }
 
 var resultMessagePool = sync.Pool{
@@ -215,6 +277,34 @@ func getReflectionResultMessage(val *reflect.Value) *ResultMessage {
 	return msg
 }
 
+// getEncodedResultMessage creates result message of task result encoded as json value
+func getEncodedResultMessage(val interface{}) (*ResultMessage, error) {
+	encoded, err := encodeResultValue(val)
+	if err != nil {
+		return nil, err
+	}
+	return getResultMessage(encoded), nil
+}
+
+// getFailureResultMessage creates FAILURE result of task error.
+// Error is encoded like python exception, so that celery raises it from AsyncResult.get().
+func getFailureResultMessage(err error) *ResultMessage {
+	excType := "Exception"
+	var taskErr *taskError
+	if errors.As(err, &taskErr) && taskErr.excType != "" {
+		excType = taskErr.excType
+	}
+	msg := resultMessagePool.Get().(*ResultMessage)
+	msg.Status = "FAILURE"
+	msg.Result = map[string]interface{}{
+		"exc_type":    excType,
+		"exc_message": []interface{}{err.Error()},
+		"exc_module":  "builtins",
+	}
+	msg.Traceback = err.Error()
+	return msg
+}
+
 func releaseResultMessage(v *ResultMessage) {
 	v.reset()
 	resultMessagePool.Put(v)
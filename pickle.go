@@ -0,0 +1,778 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// pickleTuple is encoded as python tuple instead of list
+type pickleTuple []interface{}
+
+// pickle opcodes
+const (
+	pickleMark           = '('
+	pickleStop           = '.'
+	picklePop            = '0'
+	picklePopMark        = '1'
+	pickleDup            = '2'
+	pickleFloat          = 'F'
+	pickleInt            = 'I'
+	pickleBinInt         = 'J'
+	pickleBinInt1        = 'K'
+	pickleLong           = 'L'
+	pickleBinInt2        = 'M'
+	pickleNone           = 'N'
+	pickleBinUnicode     = 'X'
+	pickleAppend         = 'a'
+	pickleDict           = 'd'
+	pickleEmptyDict      = '}'
+	pickleAppends        = 'e'
+	pickleGet            = 'g'
+	pickleBinGet         = 'h'
+	pickleLongBinGet     = 'j'
+	pickleList           = 'l'
+	pickleEmptyList      = ']'
+	picklePut            = 'p'
+	pickleBinPut         = 'q'
+	pickleLongBinPut     = 'r'
+	pickleSetItem        = 's'
+	pickleTupleOp        = 't'
+	pickleEmptyTuple     = ')'
+	pickleSetItems       = 'u'
+	pickleBinFloat       = 'G'
+	pickleBinString      = 'T'
+	pickleShortBinString = 'U'
+	pickleUnicode        = 'V'
+	pickleProto          = 0x80
+	pickleTuple1         = 0x85
+	pickleTuple2         = 0x86
+	pickleTuple3         = 0x87
+	pickleNewTrue        = 0x88
+	pickleNewFalse       = 0x89
+	pickleLong1          = 0x8a
+	pickleLong4          = 0x8b
+	pickleBinBytes       = 'B'
+	pickleShortBinBytes  = 'C'
+	pickleShortBinUni    = 0x8c
+	pickleBinUnicode8    = 0x8d
+	pickleBinBytes8      = 0x8e
+	pickleEmptySet       = 0x8f
+	pickleAddItems       = 0x90
+	pickleFrozenSet      = 0x91
+	pickleMemoize        = 0x94
+	pickleFrame          = 0x95
+	pickleByteArray8     = 0x96
+	pickleGlobal         = 'c'
+	pickleStackGlobal    = 0x93
+	pickleReduce         = 'R'
+	pickleBuild          = 'b'
+	pickleInst           = 'i'
+	pickleObj            = 'o'
+	pickleNewObj         = 0x81
+	pickleNewObjEx       = 0x92
+)
+
+// pickleDumps encodes value as python pickle (protocol 2).
+// Only json-compatible values are supported, other values are
+// normalized through json encoding first.
+func pickleDumps(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write([]byte{pickleProto, 2})
+	if err := pickleEncode(&buf, val); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(pickleStop)
+	return buf.Bytes(), nil
+}
+
+func pickleEncode(buf *bytes.Buffer, val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		buf.WriteByte(pickleNone)
+	case bool:
+		if v {
+			buf.WriteByte(pickleNewTrue)
+		} else {
+			buf.WriteByte(pickleNewFalse)
+		}
+	case int:
+		pickleEncodeInt(buf, int64(v))
+	case int8:
+		pickleEncodeInt(buf, int64(v))
+	case int16:
+		pickleEncodeInt(buf, int64(v))
+	case int32:
+		pickleEncodeInt(buf, int64(v))
+	case int64:
+		pickleEncodeInt(buf, v)
+	case uint8:
+		pickleEncodeInt(buf, int64(v))
+	case uint16:
+		pickleEncodeInt(buf, int64(v))
+	case uint32:
+		pickleEncodeInt(buf, int64(v))
+	case uint:
+		pickleEncodeBigInt(buf, new(big.Int).SetUint64(uint64(v)))
+	case uint64:
+		pickleEncodeBigInt(buf, new(big.Int).SetUint64(v))
+	case float32:
+		pickleEncodeFloat(buf, float64(v))
+	case float64:
+		pickleEncodeFloat(buf, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			pickleEncodeInt(buf, i)
+		} else if i, ok := new(big.Int).SetString(string(v), 10); ok {
+			pickleEncodeBigInt(buf, i)
+		} else {
+			f, err := v.Float64()
+			if err != nil {
+				return err
+			}
+			pickleEncodeFloat(buf, f)
+		}
+	case string:
+		buf.WriteByte(pickleBinUnicode)
+		binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+		buf.WriteString(v)
+	case pickleTuple:
+		if len(v) == 0 {
+			buf.WriteByte(pickleEmptyTuple)
+			return nil
+		}
+		buf.WriteByte(pickleMark)
+		for _, item := range v {
+			if err := pickleEncode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(pickleTupleOp)
+	case []interface{}:
+		buf.WriteByte(pickleEmptyList)
+		if len(v) == 0 {
+			return nil
+		}
+		buf.WriteByte(pickleMark)
+		for _, item := range v {
+			if err := pickleEncode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(pickleAppends)
+	case map[string]interface{}:
+		buf.WriteByte(pickleEmptyDict)
+		if len(v) == 0 {
+			return nil
+		}
+		buf.WriteByte(pickleMark)
+		for key, item := range v {
+			if err := pickleEncode(buf, key); err != nil {
+				return err
+			}
+			if err := pickleEncode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(pickleSetItems)
+	default:
+		// normalize other values such as structs and typed slices through json
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to pickle value of type %T: %v", v, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+		decoder.UseNumber()
+		var normalized interface{}
+		if err := decoder.Decode(&normalized); err != nil {
+			return err
+		}
+		return pickleEncode(buf, normalized)
+	}
+	return nil
+}
+
+func pickleEncodeInt(buf *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0 && v < 256:
+		buf.WriteByte(pickleBinInt1)
+		buf.WriteByte(byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		buf.WriteByte(pickleBinInt)
+		binary.Write(buf, binary.LittleEndian, int32(v))
+	default:
+		pickleEncodeBigInt(buf, big.NewInt(v))
+	}
+}
+
+// pickleEncodeBigInt encodes integer as LONG1 little endian two's complement
+func pickleEncodeBigInt(buf *bytes.Buffer, v *big.Int) {
+	if v.IsInt64() && v.Int64() >= math.MinInt32 && v.Int64() <= math.MaxInt32 {
+		pickleEncodeInt(buf, v.Int64())
+		return
+	}
+	n := v.BitLen()/8 + 1
+	data := make([]byte, n)
+	abs := new(big.Int).Set(v)
+	if v.Sign() < 0 {
+		// two's complement of negative value
+		abs.Add(abs, new(big.Int).Lsh(big.NewInt(1), uint(n*8)))
+	}
+	be := abs.Bytes()
+	for i := 0; i < len(be) && i < n; i++ {
+		data[i] = be[len(be)-1-i]
+	}
+	buf.WriteByte(pickleLong1)
+	buf.WriteByte(byte(n))
+	buf.Write(data)
+}
+
+func pickleEncodeFloat(buf *bytes.Buffer, v float64) {
+	buf.WriteByte(pickleBinFloat)
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+// PickleLoads decodes python pickle of json-compatible values.
+// Numbers are decoded as float64 and tuples and sets as []interface{}
+// to match values decoded from json by other backends.
+// Pickled python objects such as datetime and Decimal are not supported,
+// so that python tasks must return json-compatible results.
+func PickleLoads(data []byte) (interface{}, error) {
+	u := &unpickler{r: bytes.NewReader(data), memo: map[int]interface{}{}}
+	val, err := u.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpickle value: %v", err)
+	}
+	return pickleFinalize(val, 0)
+}
+
+// pickleListRef is reference to list which may still be appended to
+type pickleListRef struct {
+	items []interface{}
+}
+
+type unpickler struct {
+	r     *bytes.Reader
+	stack []interface{}
+	marks []int
+	memo  map[int]interface{}
+}
+
+func (u *unpickler) push(v interface{}) {
+	u.stack = append(u.stack, v)
+}
+
+// base returns position of last mark, items below it cannot be popped
+func (u *unpickler) base() int {
+	if len(u.marks) == 0 {
+		return 0
+	}
+	return u.marks[len(u.marks)-1]
+}
+
+func (u *unpickler) pop() (interface{}, error) {
+	if len(u.stack) <= u.base() {
+		return nil, fmt.Errorf("stack underflow")
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (interface{}, error) {
+	if len(u.stack) <= u.base() {
+		return nil, fmt.Errorf("stack underflow")
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+// popMark pops items pushed since last mark
+func (u *unpickler) popMark() ([]interface{}, error) {
+	if len(u.marks) == 0 {
+		return nil, fmt.Errorf("mark not found")
+	}
+	mark := u.marks[len(u.marks)-1]
+	u.marks = u.marks[:len(u.marks)-1]
+	if mark > len(u.stack) {
+		return nil, fmt.Errorf("stack underflow")
+	}
+	items := append([]interface{}{}, u.stack[mark:]...)
+	u.stack = u.stack[:mark]
+	return items, nil
+}
+
+func (u *unpickler) read(n uint64) ([]byte, error) {
+	if n > uint64(u.r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, n)
+	_, err := io.ReadFull(u.r, data)
+	return data, err
+}
+
+func (u *unpickler) readUint(n int) (uint64, error) {
+	data, err := u.read(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	return v, nil
+}
+
+func (u *unpickler) readLine() (string, error) {
+	var sb strings.Builder
+	for {
+		b, err := u.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return sb.String(), nil
+		}
+		sb.WriteByte(b)
+	}
+}
+
+func (u *unpickler) load() (interface{}, error) {
+	for {
+		op, err := u.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case pickleProto:
+			if _, err := u.r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case pickleFrame:
+			if _, err := u.read(8); err != nil {
+				return nil, err
+			}
+		case pickleStop:
+			return u.pop()
+		case pickleNone:
+			u.push(nil)
+		case pickleNewTrue:
+			u.push(true)
+		case pickleNewFalse:
+			u.push(false)
+		case pickleInt:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			switch line {
+			case "00":
+				u.push(false)
+			case "01":
+				u.push(true)
+			default:
+				f, err := strconv.ParseFloat(line, 64)
+				if err != nil {
+					return nil, err
+				}
+				u.push(f)
+			}
+		case pickleLong:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			f, err := strconv.ParseFloat(strings.TrimSuffix(line, "L"), 64)
+			if err != nil {
+				return nil, err
+			}
+			u.push(f)
+		case pickleBinInt:
+			v, err := u.readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			u.push(float64(int32(uint32(v))))
+		case pickleBinInt1:
+			v, err := u.readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			u.push(float64(v))
+		case pickleBinInt2:
+			v, err := u.readUint(2)
+			if err != nil {
+				return nil, err
+			}
+			u.push(float64(v))
+		case pickleLong1, pickleLong4:
+			size := 1
+			if op == pickleLong4 {
+				size = 4
+			}
+			n, err := u.readUint(size)
+			if err != nil {
+				return nil, err
+			}
+			data, err := u.read(n)
+			if err != nil {
+				return nil, err
+			}
+			u.push(pickleDecodeLong(data))
+		case pickleFloat:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			f, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, err
+			}
+			u.push(f)
+		case pickleBinFloat:
+			data, err := u.read(8)
+			if err != nil {
+				return nil, err
+			}
+			u.push(math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case pickleShortBinUni, pickleShortBinString, pickleShortBinBytes:
+			if err := u.pushString(1); err != nil {
+				return nil, err
+			}
+		case pickleBinUnicode, pickleBinString, pickleBinBytes:
+			if err := u.pushString(4); err != nil {
+				return nil, err
+			}
+		case pickleBinUnicode8, pickleBinBytes8, pickleByteArray8:
+			if err := u.pushString(8); err != nil {
+				return nil, err
+			}
+		case pickleUnicode:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			u.push(decodeRawUnicodeEscape(line))
+		case pickleEmptyList:
+			u.push(&pickleListRef{})
+		case pickleEmptyDict:
+			u.push(map[interface{}]interface{}{})
+		case pickleEmptyTuple:
+			u.push([]interface{}{})
+		case pickleEmptySet:
+			u.push(&pickleListRef{})
+		case pickleMark:
+			u.marks = append(u.marks, len(u.stack))
+		case pickleList:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			u.push(&pickleListRef{items: items})
+		case pickleTupleOp, pickleFrozenSet:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			u.push(items)
+		case pickleTuple1, pickleTuple2, pickleTuple3:
+			n := int(op-pickleTuple1) + 1
+			if len(u.stack)-u.base() < n {
+				return nil, fmt.Errorf("stack underflow")
+			}
+			items := append([]interface{}{}, u.stack[len(u.stack)-n:]...)
+			u.stack = u.stack[:len(u.stack)-n]
+			u.push(items)
+		case pickleDict:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			dict := map[interface{}]interface{}{}
+			if err := pickleSetDictItems(dict, items); err != nil {
+				return nil, err
+			}
+			u.push(dict)
+		case pickleAppend:
+			item, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := u.appendItems([]interface{}{item}); err != nil {
+				return nil, err
+			}
+		case pickleAppends, pickleAddItems:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			if err := u.appendItems(items); err != nil {
+				return nil, err
+			}
+		case pickleSetItem, pickleSetItems:
+			var items []interface{}
+			if op == pickleSetItem {
+				value, err := u.pop()
+				if err != nil {
+					return nil, err
+				}
+				key, err := u.pop()
+				if err != nil {
+					return nil, err
+				}
+				items = []interface{}{key, value}
+			} else if items, err = u.popMark(); err != nil {
+				return nil, err
+			}
+			top, err := u.top()
+			if err != nil {
+				return nil, err
+			}
+			dict, ok := top.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("setitems on %T", top)
+			}
+			if err := pickleSetDictItems(dict, items); err != nil {
+				return nil, err
+			}
+		case picklePop:
+			// like python, POP discards mark if there are no items above it
+			if len(u.marks) > 0 && len(u.stack) == u.base() {
+				u.marks = u.marks[:len(u.marks)-1]
+			} else if _, err := u.pop(); err != nil {
+				return nil, err
+			}
+		case picklePopMark:
+			if _, err := u.popMark(); err != nil {
+				return nil, err
+			}
+		case pickleDup:
+			top, err := u.top()
+			if err != nil {
+				return nil, err
+			}
+			u.push(top)
+		case picklePut, pickleBinPut, pickleLongBinPut, pickleMemoize:
+			var index int
+			switch op {
+			case picklePut:
+				line, err := u.readLine()
+				if err != nil {
+					return nil, err
+				}
+				if index, err = strconv.Atoi(line); err != nil {
+					return nil, err
+				}
+			case pickleBinPut:
+				v, err := u.readUint(1)
+				if err != nil {
+					return nil, err
+				}
+				index = int(v)
+			case pickleLongBinPut:
+				v, err := u.readUint(4)
+				if err != nil {
+					return nil, err
+				}
+				index = int(v)
+			default:
+				index = len(u.memo)
+			}
+			top, err := u.top()
+			if err != nil {
+				return nil, err
+			}
+			u.memo[index] = top
+		case pickleGet, pickleBinGet, pickleLongBinGet:
+			var index int
+			switch op {
+			case pickleGet:
+				line, err := u.readLine()
+				if err != nil {
+					return nil, err
+				}
+				if index, err = strconv.Atoi(line); err != nil {
+					return nil, err
+				}
+			case pickleBinGet:
+				v, err := u.readUint(1)
+				if err != nil {
+					return nil, err
+				}
+				index = int(v)
+			default:
+				v, err := u.readUint(4)
+				if err != nil {
+					return nil, err
+				}
+				index = int(v)
+			}
+			v, ok := u.memo[index]
+			if !ok {
+				return nil, fmt.Errorf("memo value %d not found", index)
+			}
+			u.push(v)
+		case pickleGlobal:
+			module, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			name, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			return nil, unsupportedPickleObject(module + "." + name)
+		case pickleStackGlobal:
+			name, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			module, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			return nil, unsupportedPickleObject(fmt.Sprintf("%v.%v", module, name))
+		case pickleReduce, pickleBuild, pickleInst, pickleObj, pickleNewObj, pickleNewObjEx:
+			return nil, unsupportedPickleObject("object")
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%x", op)
+		}
+	}
+}
+
+// unsupportedPickleObject returns error of pickled python object which cannot be decoded
+func unsupportedPickleObject(name string) error {
+	return fmt.Errorf("pickled python %s is not supported, return json-compatible results or configure celery with result_serializer='json'", name)
+}
+
+func (u *unpickler) pushString(size int) error {
+	n, err := u.readUint(size)
+	if err != nil {
+		return err
+	}
+	data, err := u.read(n)
+	if err != nil {
+		return err
+	}
+	u.push(string(data))
+	return nil
+}
+
+func (u *unpickler) appendItems(items []interface{}) error {
+	top, err := u.top()
+	if err != nil {
+		return err
+	}
+	list, ok := top.(*pickleListRef)
+	if !ok {
+		return fmt.Errorf("append on %T", top)
+	}
+	list.items = append(list.items, items...)
+	return nil
+}
+
+func pickleSetDictItems(dict map[interface{}]interface{}, items []interface{}) error {
+	if len(items)%2 != 0 {
+		return fmt.Errorf("odd number of dict items")
+	}
+	for i := 0; i < len(items); i += 2 {
+		key := items[i]
+		switch key.(type) {
+		case *pickleListRef, []interface{}, map[interface{}]interface{}:
+			return fmt.Errorf("unhashable dict key %T", key)
+		}
+		dict[key] = items[i+1]
+	}
+	return nil
+}
+
+// decodeRawUnicodeEscape decodes python raw-unicode-escape encoding
+// where bytes are latin-1 code points and other characters are \uXXXX escaped
+func decodeRawUnicodeEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == 'u' || s[i+1] == 'U') {
+			n := 4
+			if s[i+1] == 'U' {
+				n = 8
+			}
+			if i+2+n <= len(s) {
+				if r, err := strconv.ParseUint(s[i+2:i+2+n], 16, 32); err == nil {
+					sb.WriteRune(rune(r))
+					i += 1 + n
+					continue
+				}
+			}
+		}
+		sb.WriteRune(rune(s[i]))
+	}
+	return sb.String()
+}
+
+// pickleDecodeLong decodes little endian two's complement integer
+func pickleDecodeLong(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	be := make([]byte, len(data))
+	for i := range data {
+		be[i] = data[len(data)-1-i]
+	}
+	v := new(big.Int).SetBytes(be)
+	if data[len(data)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+	}
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// pickleFinalize converts decoded values to json-compatible go values
+func pickleFinalize(val interface{}, depth int) (interface{}, error) {
+	if depth > 1000 {
+		return nil, fmt.Errorf("pickled value is nested too deeply")
+	}
+	switch v := val.(type) {
+	case *pickleListRef:
+		return pickleFinalize(v.items, depth)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			item, err := pickleFinalize(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case map[interface{}]interface{}:
+		dict := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item, err := pickleFinalize(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			switch k := key.(type) {
+			case string:
+				dict[k] = item
+			case nil:
+				dict["null"] = item
+			case float64:
+				dict[strconv.FormatFloat(k, 'f', -1, 64)] = item
+			default:
+				dict[fmt.Sprint(k)] = item
+			}
+		}
+		return dict, nil
+	default:
+		return v, nil
+	}
+}
@@ -14,6 +14,7 @@ import (
 // RedisCeleryBackend is celery backend for redis
 type RedisCeleryBackend struct {
 	*redis.Pool
+	cluster bool
 }
 
 // NewRedisBackend creates new RedisCeleryBackend with given redis pool.
@@ -38,12 +39,12 @@ func NewRedisCeleryBackend(uri string) *RedisCeleryBackend {
 func (cb *RedisCeleryBackend) GetResult(taskID string) (*ResultMessage, error) {
 	conn := cb.Get()
 	defer conn.Close()
-	val, err := conn.Do("GET", fmt.Sprintf("celery-task-meta-%s", taskID))
+	val, err := conn.Do("GET", cb.resultKey(taskID))
 	if err != nil {
 		return nil, err
 	}
 	if val == nil {
-		return nil, fmt.Errorf("result not available")
+		return nil, ErrResultNotAvailable
 	}
 	var resultMessage ResultMessage
 	err = json.Unmarshal(val.([]byte), &resultMessage)
@@ -61,6 +62,126 @@ func (cb *RedisCeleryBackend) SetResult(taskID string, result *ResultMessage) er
 	}
 	conn := cb.Get()
 	defer conn.Close()
-	_, err = conn.Do("SETEX", fmt.Sprintf("celery-task-meta-%s", taskID), 86400, resBytes)
+	_, err = conn.Do("SETEX", cb.resultKey(taskID), 86400, resBytes)
 	return err
 }
+
+// GetResults queries redis backend to get results of multiple tasks with single MGET.
+// Results are retrieved one by one in cluster mode as keys of tasks belong to different slots.
+func (cb *RedisCeleryBackend) GetResults(taskIDs []string) ([]*ResultMessage, error) {
+	conn := cb.Get()
+	defer conn.Close()
+	values := make([][]byte, len(taskIDs))
+	if cb.cluster {
+		for i, taskID := range taskIDs {
+			val, err := redis.Bytes(conn.Do("GET", cb.resultKey(taskID)))
+			if err != nil && err != redis.ErrNil {
+				return nil, err
+			}
+			values[i] = val
+		}
+	} else if len(taskIDs) > 0 {
+		keys := make([]interface{}, len(taskIDs))
+		for i, taskID := range taskIDs {
+			keys[i] = cb.resultKey(taskID)
+		}
+		var err error
+		values, err = redis.ByteSlices(conn.Do("MGET", keys...))
+		if err != nil {
+			return nil, err
+		}
+	}
+	results := make([]*ResultMessage, len(taskIDs))
+	for i, val := range values {
+		if val == nil {
+			continue
+		}
+		var resultMessage ResultMessage
+		if err := json.Unmarshal(val, &resultMessage); err != nil {
+			return nil, err
+		}
+		results[i] = &resultMessage
+	}
+	return results, nil
+}
+
+// ForgetResult removes result from redis backend
+func (cb *RedisCeleryBackend) ForgetResult(taskID string) error {
+	conn := cb.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", cb.resultKey(taskID))
+	return err
+}
+
+// SaveGroup stores ids of tasks belonging to group encoded like celery GroupResult.as_tuple()
+func (cb *RedisCeleryBackend) SaveGroup(groupID string, taskIDs []string) error {
+	results := make([]interface{}, len(taskIDs))
+	for i, taskID := range taskIDs {
+		results[i] = []interface{}{[]interface{}{taskID, nil}, nil}
+	}
+	resBytes, err := json.Marshal(map[string]interface{}{
+		"result": []interface{}{[]interface{}{groupID, nil}, results},
+	})
+	if err != nil {
+		return err
+	}
+	conn := cb.Get()
+	defer conn.Close()
+	_, err = conn.Do("SETEX", cb.groupKey(groupID), 86400, resBytes)
+	return err
+}
+
+// GetGroup retrieves ids of tasks belonging to group
+func (cb *RedisCeleryBackend) GetGroup(groupID string) ([]string, error) {
+	conn := cb.Get()
+	defer conn.Close()
+	val, err := redis.Bytes(conn.Do("GET", cb.groupKey(groupID)))
+	if err == redis.ErrNil {
+		return nil, fmt.Errorf("group %s not available", groupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		Result []json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(val, &meta); err != nil || len(meta.Result) != 2 {
+		return nil, fmt.Errorf("malformed group result %s", val)
+	}
+	var results [][]interface{}
+	if err := json.Unmarshal(meta.Result[1], &results); err != nil {
+		return nil, fmt.Errorf("malformed group result %s: %v", val, err)
+	}
+	taskIDs := make([]string, len(results))
+	for i, result := range results {
+		var ok bool
+		if len(result) > 0 {
+			var id []interface{}
+			if id, ok = result[0].([]interface{}); ok && len(id) > 0 {
+				taskIDs[i], ok = id[0].(string)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("malformed group result %s", val)
+		}
+	}
+	return taskIDs, nil
+}
+
+// DeleteGroup removes group from redis backend
+func (cb *RedisCeleryBackend) DeleteGroup(groupID string) error {
+	conn := cb.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", cb.groupKey(groupID))
+	return err
+}
+
+// resultKey returns redis key of task result, the same as celery redis backend
+func (cb *RedisCeleryBackend) resultKey(taskID string) string {
+	return fmt.Sprintf("celery-task-meta-%s", taskID)
+}
+
+// groupKey returns redis key of group result, the same as celery redis backend
+func (cb *RedisCeleryBackend) groupKey(groupID string) string {
+	return fmt.Sprintf("celery-taskset-meta-%s", groupID)
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const redisClusterSlots = 16384
+
+// redisCluster routes redis commands to nodes of redis cluster based on key slot
+type redisCluster struct {
+	addrs   []string
+	options []redis.DialOption
+
+	mu    sync.RWMutex
+	slots [redisClusterSlots]string
+	pools map[string]*redis.Pool
+}
+
+// NewRedisClusterPool creates pool of connections to redis cluster from given
+// semicolon separated redis urls of cluster nodes such as redis://host1:7000;redis://host2:7001.
+// Commands are routed to the node owning key slot and MOVED/ASK redirections are followed.
+// Connections support Do only; pipelining with Send/Flush/Receive is not supported.
+func NewRedisClusterPool(uri string, options ...redis.DialOption) (*redis.Pool, error) {
+	cluster := &redisCluster{
+		options: options,
+		pools:   map[string]*redis.Pool{},
+	}
+	for _, part := range strings.Split(uri, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		u, err := url.Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "redis" && u.Scheme != "rediss" {
+			return nil, fmt.Errorf("invalid redis URL scheme: %s", u.Scheme)
+		}
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			// assume port is missing
+			host = u.Host
+			port = "6379"
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		cluster.addrs = append(cluster.addrs, net.JoinHostPort(host, port))
+		if u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				cluster.options = append(cluster.options, redis.DialPassword(password))
+			}
+		}
+		if u.Scheme == "rediss" {
+			cluster.options = append(cluster.options, redis.DialUseTLS(true))
+		}
+	}
+	if len(cluster.addrs) == 0 {
+		return nil, fmt.Errorf("no redis cluster address in %s", uri)
+	}
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &redisClusterConn{cluster: cluster}, nil
+		},
+	}, nil
+}
+
+// NewRedisClusterBroker creates new RedisCeleryBroker connected to redis cluster
+func NewRedisClusterBroker(uri string) (*RedisCeleryBroker, error) {
+	pool, err := NewRedisClusterPool(uri)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisBroker(pool), nil
+}
+
+// NewRedisClusterBackend creates new RedisCeleryBackend connected to redis cluster.
+// Result keys stay in celery standard untagged celery-task-meta-<id> format instead of being hash tagged,
+// so that python clients and workers share results, which are therefore retrieved one by one.
+func NewRedisClusterBackend(uri string) (*RedisCeleryBackend, error) {
+	pool, err := NewRedisClusterPool(uri)
+	if err != nil {
+		return nil, err
+	}
+	backend := NewRedisBackend(pool)
+	backend.cluster = true
+	return backend, nil
+}
+
+// pool returns connection pool of given cluster node
+func (c *redisCluster) pool(addr string) *redis.Pool {
+	c.mu.RLock()
+	pool, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return pool
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pool, ok := c.pools[addr]; ok {
+		return pool
+	}
+	pool = &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, c.options...)
+		},
+	}
+	c.pools[addr] = pool
+	return pool
+}
+
+// refresh reloads slot mapping from any reachable cluster node
+func (c *redisCluster) refresh() error {
+	c.mu.RLock()
+	addrs := append([]string{}, c.addrs...)
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn := c.pool(addr).Get()
+		reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var slots [redisClusterSlots]string
+		for _, r := range reply {
+			slotRange, err := redis.Values(r, nil)
+			if err != nil || len(slotRange) < 3 {
+				return fmt.Errorf("malformed CLUSTER SLOTS reply: %v", r)
+			}
+			start, _ := redis.Int(slotRange[0], nil)
+			end, _ := redis.Int(slotRange[1], nil)
+			master, err := redis.Values(slotRange[2], nil)
+			if err != nil || len(master) < 2 {
+				return fmt.Errorf("malformed CLUSTER SLOTS node: %v", slotRange[2])
+			}
+			host, _ := redis.String(master[0], nil)
+			port, _ := redis.Int(master[1], nil)
+			if host == "" {
+				host, _, _ = net.SplitHostPort(addr)
+			}
+			for slot := start; slot <= end && slot < redisClusterSlots; slot++ {
+				slots[slot] = net.JoinHostPort(host, strconv.Itoa(port))
+			}
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("failed to load redis cluster slots: %v", lastErr)
+}
+
+// nodeAddr returns address of node owning given slot
+func (c *redisCluster) nodeAddr(slot int) (string, error) {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr != "" {
+		return addr, nil
+	}
+	if err := c.refresh(); err != nil {
+		return "", err
+	}
+	c.mu.RLock()
+	addr = c.slots[slot]
+	c.mu.RUnlock()
+	if addr == "" {
+		return "", fmt.Errorf("slot %d is not served by any redis cluster node", slot)
+	}
+	return addr, nil
+}
+
+// do executes command on node owning its key following cluster redirections
+func (c *redisCluster) do(cmd string, args ...interface{}) (interface{}, error) {
+	var addr string
+	key, ok := redisCommandKey(cmd, args)
+	if ok {
+		var err error
+		if addr, err = c.nodeAddr(redisClusterSlot(key)); err != nil {
+			return nil, err
+		}
+	} else {
+		addr = c.addrs[0]
+	}
+	asking := false
+	for redirects := 0; redirects < 5; redirects++ {
+		conn := c.pool(addr).Get()
+		if asking {
+			if _, err := conn.Do("ASKING"); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		reply, err := conn.Do(cmd, args...)
+		conn.Close()
+		var redisErr redis.Error
+		if !errors.As(err, &redisErr) {
+			return reply, err
+		}
+		fields := strings.Fields(string(redisErr))
+		switch {
+		case len(fields) == 3 && fields[0] == "MOVED":
+			// slot mapping changed, reload it before retrying command
+			if err := c.refresh(); err != nil {
+				return nil, err
+			}
+			addr, asking = fields[2], false
+		case len(fields) == 3 && fields[0] == "ASK":
+			addr, asking = fields[2], true
+		default:
+			return reply, err
+		}
+	}
+	return nil, fmt.Errorf("too many redis cluster redirections for %s", cmd)
+}
+
+// redisClusterConn is redis.Conn routing each command to redis cluster node
+type redisClusterConn struct {
+	cluster *redisCluster
+}
+
+func (conn *redisClusterConn) Close() error {
+	return nil
+}
+
+func (conn *redisClusterConn) Err() error {
+	return nil
+}
+
+func (conn *redisClusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	// redis.Pool flushes connection with empty command on release
+	if cmd == "" {
+		return nil, nil
+	}
+	return conn.cluster.do(cmd, args...)
+}
+
+func (conn *redisClusterConn) Send(cmd string, args ...interface{}) error {
+	return fmt.Errorf("redis cluster connection does not support pipelining")
+}
+
+func (conn *redisClusterConn) Flush() error {
+	return fmt.Errorf("redis cluster connection does not support pipelining")
+}
+
+func (conn *redisClusterConn) Receive() (interface{}, error) {
+	return nil, fmt.Errorf("redis cluster connection does not support pipelining")
+}
+
+// redisCommandKey returns key used for routing given command
+func redisCommandKey(cmd string, args []interface{}) (string, bool) {
+	index := 0
+	switch strings.ToUpper(cmd) {
+	case "PING", "INFO", "CLUSTER", "ROLE":
+		return "", false
+	case "XGROUP":
+		index = 1
+	case "EVAL", "EVALSHA":
+		index = 2
+	case "XREAD", "XREADGROUP":
+		index = -1
+		for i, arg := range args {
+			if s, ok := arg.(string); ok && strings.ToUpper(s) == "STREAMS" {
+				index = i + 1
+				break
+			}
+		}
+	}
+	if index < 0 || index >= len(args) {
+		return "", false
+	}
+	switch key := args[index].(type) {
+	case string:
+		return key, true
+	case []byte:
+		return string(key), true
+	default:
+		return fmt.Sprint(key), true
+	}
+}
+
+// redisClusterSlot returns hash slot of key honoring {hash tags}
+func redisClusterSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) used by redis cluster
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisSentinelConfig stores configuration parsed from celery-style sentinel url
+type redisSentinelConfig struct {
+	addrs      []string
+	masterName string
+	password   string
+	db         int
+}
+
+// parseRedisSentinelURL parses celery-style sentinel url such as
+// sentinel://:password@host1:26379/0;sentinel://host2:26379?master_name=mymaster
+func parseRedisSentinelURL(uri string) (*redisSentinelConfig, error) {
+	config := &redisSentinelConfig{}
+	for _, part := range strings.Split(uri, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		u, err := url.Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "sentinel" {
+			return nil, fmt.Errorf("invalid sentinel URL scheme: %s", u.Scheme)
+		}
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			// assume port is missing
+			host = u.Host
+			port = "26379"
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		config.addrs = append(config.addrs, net.JoinHostPort(host, port))
+		if u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				config.password = password
+			}
+		}
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			config.db, err = strconv.Atoi(db)
+			if err != nil {
+				return nil, fmt.Errorf("invalid database: %s", db)
+			}
+		}
+		if masterName := u.Query().Get("master_name"); masterName != "" {
+			config.masterName = masterName
+		}
+	}
+	if len(config.addrs) == 0 {
+		return nil, fmt.Errorf("no sentinel address in %s", uri)
+	}
+	if config.masterName == "" {
+		return nil, fmt.Errorf("master_name is required for sentinel URL %s", uri)
+	}
+	return config, nil
+}
+
+// redisSentinelRoleCheckInterval is idle time after which role of pooled connection is checked on borrow
+const redisSentinelRoleCheckInterval = time.Minute
+
+// NewRedisSentinelPool creates pool of redis connections to master resolved through sentinel.
+// Master address is resolved for every new connection and connections to
+// demoted master idle for more than a minute are discarded on borrow so that pool follows failover.
+// Redis closes client connections when master is demoted, so that recently used connections are not checked.
+func NewRedisSentinelPool(uri string, options ...redis.DialOption) (*redis.Pool, error) {
+	config, err := parseRedisSentinelURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	if config.password != "" {
+		options = append(options, redis.DialPassword(config.password))
+	}
+	if config.db != 0 {
+		options = append(options, redis.DialDatabase(config.db))
+	}
+	return &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			addr, err := config.masterAddr()
+			if err != nil {
+				return nil, err
+			}
+			c, err := redis.Dial("tcp", addr, options...)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkRedisMasterRole(c); err != nil {
+				c.Close()
+				return nil, err
+			}
+			return c, nil
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < redisSentinelRoleCheckInterval {
+				return nil
+			}
+			return checkRedisMasterRole(c)
+		},
+	}, nil
+}
+
+// NewRedisSentinelBroker creates new RedisCeleryBroker connected to master resolved through sentinel
+func NewRedisSentinelBroker(uri string) (*RedisCeleryBroker, error) {
+	pool, err := NewRedisSentinelPool(uri)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisBroker(pool), nil
+}
+
+// NewRedisSentinelBackend creates new RedisCeleryBackend connected to master resolved through sentinel
+func NewRedisSentinelBackend(uri string) (*RedisCeleryBackend, error) {
+	pool, err := NewRedisSentinelPool(uri)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisBackend(pool), nil
+}
+
+// masterAddr asks sentinels in order for current address of master
+func (config *redisSentinelConfig) masterAddr() (string, error) {
+	var lastErr error
+	for _, addr := range config.addrs {
+		c, err := redis.Dial("tcp", addr,
+			redis.DialConnectTimeout(time.Second),
+			redis.DialReadTimeout(time.Second),
+			redis.DialWriteTimeout(time.Second),
+		)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", config.masterName))
+		c.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply) != 2 {
+			lastErr = fmt.Errorf("malformed sentinel reply %v from %s", reply, addr)
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+	return "", fmt.Errorf("failed to resolve redis master %s through sentinel: %v", config.masterName, lastErr)
+}
+
+// checkRedisMasterRole returns error if connected redis server is not master
+func checkRedisMasterRole(c redis.Conn) error {
+	reply, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return fmt.Errorf("malformed ROLE reply")
+	}
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return fmt.Errorf("redis server role is %s instead of master", role)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisStreamsBroker is celery broker for redis based on redis streams.
+// Messages are delivered through consumer group and are acknowledged only
+// after task is executed, providing at-least-once delivery.
+// It is not compatible with python celery and is meant for go-only deployments.
+// Reclaiming messages of crashed consumers requires XAUTOCLAIM of redis 6.2 or later,
+// messages are only read on older servers.
+type RedisStreamsBroker struct {
+	*redis.Pool
+	StreamName   string
+	GroupName    string
+	ConsumerName string
+	// MaxLen trims stream approximately to given length on every message sent (0 disables trimming)
+	MaxLen int64
+	// ClaimMinIdle is the idle time after which pending messages of other consumers are reclaimed (0 disables reclaiming)
+	ClaimMinIdle time.Duration
+
+	groupLock        sync.Mutex
+	groupCreated     bool
+	lastClaim        time.Time
+	claimUnsupported bool
+	entryIDs         sync.Map
+	brokerSerializers
+}
+
+// RedisStreamsPending represents summary of messages delivered to consumer group but not yet acknowledged
+type RedisStreamsPending struct {
+	Count     int64
+	Consumers map[string]int64
+}
+
+// NewRedisStreamsBroker creates new RedisStreamsBroker with given redis connection pool
+func NewRedisStreamsBroker(conn *redis.Pool) *RedisStreamsBroker {
+	hostname, _ := os.Hostname()
+	return &RedisStreamsBroker{
+		Pool:         conn,
+		StreamName:   "celery:stream",
+		GroupName:    "gocelery",
+		ConsumerName: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ClaimMinIdle: 5 * time.Minute,
+	}
+}
+
+// SendCeleryMessage appends CeleryMessage to redis stream
+func (b *RedisStreamsBroker) SendCeleryMessage(message *CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	conn := b.Get()
+	defer conn.Close()
+	args := redis.Args{b.StreamName}
+	if b.MaxLen > 0 {
+		args = args.Add("MAXLEN", "~", b.MaxLen)
+	}
+	args = args.Add("*", "body", jsonBytes)
+	_, err = conn.Do("XADD", args...)
+	return err
+}
+
+// GetTaskMessage retrieves task message from redis stream.
+// Pending messages idle for longer than ClaimMinIdle are reclaimed first.
+func (b *RedisStreamsBroker) GetTaskMessage() (*TaskMessage, error) {
+	conn := b.Get()
+	defer conn.Close()
+	if err := b.createGroup(conn); err != nil {
+		return nil, err
+	}
+	entryID, body, err := b.claimMessage(conn)
+	if entryID == "" && err == nil {
+		entryID, body, err = b.readMessage(conn)
+	}
+	if entryID == "" {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("null message received from redis stream")
+	}
+	var taskMessage *TaskMessage
+	if err == nil {
+		var message CeleryMessage
+		if err = json.Unmarshal(body, &message); err == nil {
+			if taskMessage = b.decodeTaskMessage(&message); taskMessage == nil {
+				err = fmt.Errorf("failed to decode task message of stream entry %s", entryID)
+			}
+		}
+	}
+	if err != nil {
+		// malformed or trimmed entries can never be processed
+		if _, ackErr := conn.Do("XACK", b.StreamName, b.GroupName, entryID); ackErr != nil {
+			return nil, ackErr
+		}
+		return nil, err
+	}
+	b.entryIDs.Store(taskMessage.ID, entryID)
+	return taskMessage, nil
+}
+
+// AckTaskMessage acknowledges stream entry of executed task message
+func (b *RedisStreamsBroker) AckTaskMessage(message *TaskMessage) error {
+	entryID, ok := b.entryIDs.Load(message.ID)
+	if !ok {
+		return fmt.Errorf("no pending stream entry for task %s", message.ID)
+	}
+	conn := b.Get()
+	defer conn.Close()
+	if _, err := conn.Do("XACK", b.StreamName, b.GroupName, entryID); err != nil {
+		return err
+	}
+	b.entryIDs.Delete(message.ID)
+	return nil
+}
+
+// Pending returns number of delivered but unacknowledged messages in total and per consumer
+func (b *RedisStreamsBroker) Pending() (*RedisStreamsPending, error) {
+	conn := b.Get()
+	defer conn.Close()
+	if err := b.createGroup(conn); err != nil {
+		return nil, err
+	}
+	reply, err := redis.Values(conn.Do("XPENDING", b.StreamName, b.GroupName))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 4 {
+		return nil, fmt.Errorf("malformed XPENDING reply: %v", reply)
+	}
+	count, err := redis.Int64(reply[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	pending := &RedisStreamsPending{
+		Count:     count,
+		Consumers: map[string]int64{},
+	}
+	consumers, err := redis.Values(reply[3], nil)
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+	for _, consumer := range consumers {
+		fields, err := redis.Values(consumer, nil)
+		if err != nil || len(fields) != 2 {
+			return nil, fmt.Errorf("malformed XPENDING consumer reply: %v", consumer)
+		}
+		name, err := redis.String(fields[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		// consumer count is returned as bulk string
+		consumerCount, err := redis.Int64(fields[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		pending.Consumers[name] = consumerCount
+	}
+	return pending, nil
+}
+
+// Trim trims redis stream approximately to given length
+func (b *RedisStreamsBroker) Trim(maxLen int64) (int64, error) {
+	conn := b.Get()
+	defer conn.Close()
+	return redis.Int64(conn.Do("XTRIM", b.StreamName, "MAXLEN", "~", maxLen))
+}
+
+// createGroup creates consumer group and stream if they do not exist yet
+func (b *RedisStreamsBroker) createGroup(conn redis.Conn) error {
+	b.groupLock.Lock()
+	defer b.groupLock.Unlock()
+	if b.groupCreated {
+		return nil
+	}
+	_, err := conn.Do("XGROUP", "CREATE", b.StreamName, b.GroupName, "0", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	b.groupCreated = true
+	return nil
+}
+
+// readMessage reads next new message delivered to consumer group without blocking
+func (b *RedisStreamsBroker) readMessage(conn redis.Conn) (string, []byte, error) {
+	reply, err := conn.Do("XREADGROUP", "GROUP", b.GroupName, b.ConsumerName, "COUNT", 1, "STREAMS", b.StreamName, ">")
+	if err != nil || reply == nil {
+		return "", nil, err
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil || len(streams) == 0 {
+		return "", nil, err
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) != 2 {
+		return "", nil, fmt.Errorf("malformed XREADGROUP reply: %v", streams[0])
+	}
+	entries, err := redis.Values(stream[1], nil)
+	if err != nil || len(entries) == 0 {
+		return "", nil, err
+	}
+	return parseStreamEntry(entries[0])
+}
+
+// claimMessage takes over single message that has been pending for longer than ClaimMinIdle
+func (b *RedisStreamsBroker) claimMessage(conn redis.Conn) (string, []byte, error) {
+	if b.ClaimMinIdle <= 0 {
+		return "", nil, nil
+	}
+	b.groupLock.Lock()
+	if b.claimUnsupported || time.Since(b.lastClaim) < b.ClaimMinIdle/2 {
+		b.groupLock.Unlock()
+		return "", nil, nil
+	}
+	b.lastClaim = time.Now()
+	b.groupLock.Unlock()
+	b.forgetReclaimedEntries(conn)
+
+	// ids are claimed first, as redis 6.2 returns nil instead of entries deleted by trimming
+	reply, err := redis.Values(conn.Do("XAUTOCLAIM", b.StreamName, b.GroupName, b.ConsumerName, b.ClaimMinIdle.Milliseconds(), "0-0", "COUNT", 1, "JUSTID"))
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+			log.Printf("redis_streams_broker: reclaiming pending messages is disabled, XAUTOCLAIM requires redis 6.2: %v", err)
+			b.groupLock.Lock()
+			b.claimUnsupported = true
+			b.groupLock.Unlock()
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	if len(reply) < 2 {
+		return "", nil, fmt.Errorf("malformed XAUTOCLAIM reply: %v", reply)
+	}
+	entryIDs, err := redis.Strings(reply[1], nil)
+	if err != nil || len(entryIDs) == 0 {
+		return "", nil, err
+	}
+	// more messages may be waiting to be reclaimed
+	b.groupLock.Lock()
+	b.lastClaim = time.Time{}
+	b.groupLock.Unlock()
+	return b.rangeEntry(conn, entryIDs[0])
+}
+
+// rangeEntry returns body of stream entry with given id.
+// Entry deleted by trimming is returned with error, so that it is acknowledged.
+func (b *RedisStreamsBroker) rangeEntry(conn redis.Conn, entryID string) (string, []byte, error) {
+	entries, err := redis.Values(conn.Do("XRANGE", b.StreamName, entryID, entryID))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return entryID, nil, fmt.Errorf("stream entry %s is not available", entryID)
+	}
+	return parseStreamEntry(entries[0])
+}
+
+// forgetReclaimedEntries forgets entries of tasks which are no longer pending for consumer,
+// e.g. because they were reclaimed by other consumers and acknowledged by them
+func (b *RedisStreamsBroker) forgetReclaimedEntries(conn redis.Conn) {
+	b.entryIDs.Range(func(taskID, entryID interface{}) bool {
+		reply, err := redis.Values(conn.Do("XPENDING", b.StreamName, b.GroupName, entryID, entryID, 1, b.ConsumerName))
+		if err != nil {
+			return false
+		}
+		if len(reply) == 0 {
+			b.entryIDs.Delete(taskID)
+		}
+		return true
+	})
+}
+
+// parseStreamEntry returns id and body field of single stream entry
+func parseStreamEntry(entry interface{}) (string, []byte, error) {
+	fields, err := redis.Values(entry, nil)
+	if err != nil || len(fields) != 2 {
+		return "", nil, fmt.Errorf("malformed stream entry: %v", entry)
+	}
+	entryID, err := redis.String(fields[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	// fields of entries deleted by trimming are nil
+	values, err := redis.StringMap(fields[1], nil)
+	if err != nil {
+		return entryID, nil, fmt.Errorf("stream entry %s is not available: %v", entryID, err)
+	}
+	body, ok := values["body"]
+	if !ok {
+		return entryID, nil, fmt.Errorf("stream entry %s has no body", entryID)
+	}
+	return entryID, []byte(body), nil
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Task states stored in backends, the same as celery.states
+const (
+	// StatePending is state of unknown tasks, which are waiting for execution
+	StatePending = "PENDING"
+	// StateReceived is state of tasks received by worker
+	StateReceived = "RECEIVED"
+	// StateStarted is state of tasks started by worker
+	StateStarted = "STARTED"
+	// StateRetry is state of tasks being retried
+	StateRetry = "RETRY"
+	// StateSuccess is state of tasks executed successfully
+	StateSuccess = "SUCCESS"
+	// StateFailure is state of tasks which failed
+	StateFailure = "FAILURE"
+	// StateRevoked is state of revoked tasks
+	StateRevoked = "REVOKED"
+)
+
+// isReadyState reports whether tasks of given state are finished
+func isReadyState(state string) bool {
+	return state == StateSuccess || state == StateFailure || state == StateRevoked
+}
+
+// CeleryTimeLayout is layout of date_done of task results in python isoformat
+const CeleryTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// ResultDateDone returns time result was finished at or current time if it is not set
+func ResultDateDone(result *ResultMessage) time.Time {
+	if dateDone, err := parseTimeArgument(result.DateDone); err == nil {
+		return dateDone.UTC()
+	}
+	return time.Now().UTC()
+}
+
+// defaultPollInterval is interval between polls of backend while waiting for results
+const defaultPollInterval = 50 * time.Millisecond
+
+// poller waits between polls of backend doubling interval up to maximum interval
+type poller struct {
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+// newPoller creates poller with given initial and maximum interval
+func newPoller(interval, maxInterval time.Duration) *poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	return &poller{interval: interval, maxInterval: maxInterval}
+}
+
+// wait waits for next poll and returns error of context if it is done first
+func (p *poller) wait(ctx context.Context) error {
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	p.interval *= 2
+	if p.interval > p.maxInterval {
+		p.interval = p.maxInterval
+	}
+	return nil
+}
+
+// ResultError is error of task which failed or was revoked.
+// Python exceptions are described by their type and message.
+type ResultError struct {
+	TaskID    string
+	State     string
+	ExcType   string
+	Message   string
+	Traceback string
+}
+
+// Error returns description of task error
+func (e *ResultError) Error() string {
+	if e.ExcType == "" {
+		return fmt.Sprintf("task %s %s: %s", e.TaskID, e.State, e.Message)
+	}
+	return fmt.Sprintf("task %s %s: %s: %s", e.TaskID, e.State, e.ExcType, e.Message)
+}
+
+// newResultError creates ResultError from failed result encoded like python exception
+func newResultError(meta *ResultMessage) *ResultError {
+	resultErr := &ResultError{
+		TaskID:    meta.ID,
+		State:     meta.Status,
+		Traceback: tracebackString(meta.Traceback),
+	}
+	exc, ok := meta.Result.(map[string]interface{})
+	if !ok {
+		if meta.Result != nil {
+			resultErr.Message = fmt.Sprint(meta.Result)
+		}
+		return resultErr
+	}
+	resultErr.ExcType, _ = exc["exc_type"].(string)
+	switch msg := exc["exc_message"].(type) {
+	case string:
+		resultErr.Message = msg
+	case []interface{}:
+		if len(msg) == 1 {
+			resultErr.Message = fmt.Sprint(msg[0])
+		} else if len(msg) > 1 {
+			resultErr.Message = fmt.Sprint(msg...)
+		}
+	}
+	return resultErr
+}
+
+// tracebackString returns traceback stored in backend as string
+func tracebackString(traceback interface{}) string {
+	if traceback == nil {
+		return ""
+	}
+	if s, ok := traceback.(string); ok {
+		return s
+	}
+	return fmt.Sprint(traceback)
+}
+
+// getMeta retrieves stored result of task or nil if task is pending.
+// Results of finished tasks are cached.
+func (ar *AsyncResult) getMeta() (*ResultMessage, error) {
+	if ar.result != nil {
+		return ar.result, nil
+	}
+	meta, err := ar.backend.GetResult(ar.TaskID)
+	if errors.Is(err, ErrResultNotAvailable) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ar.setMeta(meta), nil
+}
+
+// setMeta prepares result retrieved from backend and caches it if task is finished
+func (ar *AsyncResult) setMeta(meta *ResultMessage) *ResultMessage {
+	if meta == nil {
+		return nil
+	}
+	if meta.ID == "" {
+		meta.ID = ar.TaskID
+	}
+	meta.Result = unwrapKombuTypes(meta.Result)
+	if isReadyState(meta.Status) {
+		ar.result = meta
+	}
+	return meta
+}
+
+// resultValue returns value of finished task or ResultError if it failed or was revoked
+func resultValue(meta *ResultMessage) (interface{}, error) {
+	if meta.Status != StateSuccess {
+		return nil, newResultError(meta)
+	}
+	return meta.Result, nil
+}
+
+// State returns state of task, which is StatePending for unknown tasks
+func (ar *AsyncResult) State() (string, error) {
+	meta, err := ar.getMeta()
+	if err != nil || meta == nil {
+		return StatePending, err
+	}
+	return meta.Status, nil
+}
+
+// Successful checks if task succeeded
+func (ar *AsyncResult) Successful() (bool, error) {
+	state, err := ar.State()
+	return state == StateSuccess, err
+}
+
+// Failed checks if task failed
+func (ar *AsyncResult) Failed() (bool, error) {
+	state, err := ar.State()
+	return state == StateFailure, err
+}
+
+// Info returns stored result of task regardless of its state,
+// i.e. result of successful task, exception of failed task or metadata of running task
+func (ar *AsyncResult) Info() (interface{}, error) {
+	meta, err := ar.getMeta()
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return meta.Result, nil
+}
+
+// Traceback returns traceback of failed task
+func (ar *AsyncResult) Traceback() (string, error) {
+	meta, err := ar.getMeta()
+	if err != nil || meta == nil {
+		return "", err
+	}
+	return tracebackString(meta.Traceback), nil
+}
+
+// DateDone returns time task finished at or zero time if it is not finished
+func (ar *AsyncResult) DateDone() (time.Time, error) {
+	meta, err := ar.getMeta()
+	if err != nil || meta == nil || meta.DateDone == "" {
+		return time.Time{}, err
+	}
+	return parseTimeArgument(meta.DateDone)
+}
+
+// Children returns results of tasks started by task
+func (ar *AsyncResult) Children() ([]interface{}, error) {
+	meta, err := ar.getMeta()
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return meta.Children, nil
+}
+
+// Forget removes stored result of task from backend
+func (ar *AsyncResult) Forget() error {
+	backend, ok := ar.backend.(CeleryForgettingBackend)
+	if !ok {
+		return fmt.Errorf("backend %T does not support forgetting results", ar.backend)
+	}
+	if err := backend.ForgetResult(ar.TaskID); err != nil {
+		return err
+	}
+	ar.result = nil
+	return nil
+}
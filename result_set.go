@@ -0,0 +1,214 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"context"
+	"time"
+)
+
+// ResultSet is collection of results of multiple tasks like celery ResultSet.
+// Results of pending tasks are retrieved at once from backends implementing CeleryBatchBackend,
+// e.g. with single MGET from redis, and one by one from other backends.
+type ResultSet struct {
+	Results []*AsyncResult
+
+	// PollInterval is initial interval between polls of backends while waiting for results
+	PollInterval time.Duration
+	// MaxPollInterval limits interval doubled after each poll, no backoff is used if it is not greater than PollInterval
+	MaxPollInterval time.Duration
+}
+
+// NewResultSet creates ResultSet of given results
+func NewResultSet(results ...*AsyncResult) *ResultSet {
+	return &ResultSet{
+		Results:      results,
+		PollInterval: defaultPollInterval,
+	}
+}
+
+// CompletedResult is result of finished task of ResultSet sent by AsCompleted
+type CompletedResult struct {
+	Index  int // index of task in ResultSet
+	TaskID string
+	Result interface{}
+	Err    error // ResultError if task failed or was revoked, or error of backend if Index is -1
+}
+
+// TaskIDs returns ids of tasks in ResultSet
+func (rs *ResultSet) TaskIDs() []string {
+	taskIDs := make([]string, len(rs.Results))
+	for i, ar := range rs.Results {
+		taskIDs[i] = ar.TaskID
+	}
+	return taskIDs
+}
+
+// update retrieves results of unfinished tasks grouping them by backend
+func (rs *ResultSet) update() error {
+	batches := map[CeleryBatchBackend][]*AsyncResult{}
+	for _, ar := range rs.Results {
+		if ar.result != nil {
+			continue
+		}
+		if backend, ok := ar.backend.(CeleryBatchBackend); ok {
+			batches[backend] = append(batches[backend], ar)
+			continue
+		}
+		if _, err := ar.getMeta(); err != nil {
+			return err
+		}
+	}
+	for backend, results := range batches {
+		taskIDs := make([]string, len(results))
+		for i, ar := range results {
+			taskIDs[i] = ar.TaskID
+		}
+		metas, err := backend.GetResults(taskIDs)
+		if err != nil {
+			return err
+		}
+		for i, meta := range metas {
+			results[i].setMeta(meta)
+		}
+	}
+	return nil
+}
+
+// Ready checks if all tasks are finished
+func (rs *ResultSet) Ready() (bool, error) {
+	if err := rs.update(); err != nil {
+		return false, err
+	}
+	for _, ar := range rs.Results {
+		if ar.result == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Completed returns number of tasks which succeeded
+func (rs *ResultSet) Completed() (int, error) {
+	if err := rs.update(); err != nil {
+		return 0, err
+	}
+	completed := 0
+	for _, ar := range rs.Results {
+		if ar.result != nil && ar.result.Status == StateSuccess {
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// Join waits for all tasks and returns their results in order of ResultSet.
+// It polls backends until results are available or context is done
+// and returns ResultError as soon as any task fails or is revoked and errors of backends right away.
+func (rs *ResultSet) Join(ctx context.Context) ([]interface{}, error) {
+	p := newPoller(rs.PollInterval, rs.MaxPollInterval)
+	for {
+		if err := rs.update(); err != nil {
+			return nil, err
+		}
+		ready := true
+		for _, ar := range rs.Results {
+			if ar.result == nil {
+				ready = false
+			} else if _, err := resultValue(ar.result); err != nil {
+				return nil, err
+			}
+		}
+		if ready {
+			values := make([]interface{}, len(rs.Results))
+			for i, ar := range rs.Results {
+				values[i] = ar.result.Result
+			}
+			return values, nil
+		}
+		if err := p.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// AsCompleted sends results of tasks to returned channel as they finish.
+// Channel is closed after results of all tasks are sent or context is done.
+// Error of backend is sent as CompletedResult with Index -1 before channel is closed.
+func (rs *ResultSet) AsCompleted(ctx context.Context) <-chan CompletedResult {
+	completed := make(chan CompletedResult, len(rs.Results))
+	go func() {
+		defer close(completed)
+		sent := make([]bool, len(rs.Results))
+		remaining := len(rs.Results)
+		p := newPoller(rs.PollInterval, rs.MaxPollInterval)
+		for remaining > 0 {
+			if err := rs.update(); err != nil {
+				completed <- CompletedResult{Index: -1, Err: err}
+				return
+			}
+			for i, ar := range rs.Results {
+				if sent[i] || ar.result == nil {
+					continue
+				}
+				val, err := resultValue(ar.result)
+				completed <- CompletedResult{Index: i, TaskID: ar.TaskID, Result: val, Err: err}
+				sent[i] = true
+				remaining--
+			}
+			if remaining == 0 || p.wait(ctx) != nil {
+				return
+			}
+		}
+	}()
+	return completed
+}
+
+// Forget removes stored results of all tasks from their backends
+func (rs *ResultSet) Forget() error {
+	for _, ar := range rs.Results {
+		if err := ar.Forget(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GroupResult is ResultSet of tasks belonging to group like celery GroupResult
+type GroupResult struct {
+	ID string
+	*ResultSet
+}
+
+// NewGroupResult creates GroupResult of given results
+func NewGroupResult(groupID string, results ...*AsyncResult) *GroupResult {
+	return &GroupResult{
+		ID:        groupID,
+		ResultSet: NewResultSet(results...),
+	}
+}
+
+// RestoreGroupResult restores GroupResult saved in backend
+func RestoreGroupResult(backend CeleryGroupBackend, groupID string) (*GroupResult, error) {
+	taskIDs, err := backend.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*AsyncResult, len(taskIDs))
+	for i, taskID := range taskIDs {
+		results[i] = NewAsyncResult(taskID, backend)
+	}
+	return NewGroupResult(groupID, results...), nil
+}
+
+// Save stores ids of tasks of group in backend, so that it can be restored with RestoreGroupResult
+func (gr *GroupResult) Save(backend CeleryGroupBackend) error {
+	return backend.SaveGroup(gr.ID, gr.TaskIDs())
+}
+
+// Delete removes group saved in backend
+func (gr *GroupResult) Delete(backend CeleryGroupBackend) error {
+	return backend.DeleteGroup(gr.ID)
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Serializer encodes and decodes task message bodies of its content type
+type Serializer interface {
+	// ContentType returns mime type of encoded data such as application/json
+	ContentType() string
+	// ContentEncoding returns character encoding of encoded data, binary for binary formats
+	ContentEncoding() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	serializers     = map[string]Serializer{}
+	serializerNames = map[string]string{}
+	serializersLock sync.RWMutex
+)
+
+func init() {
+	RegisterSerializer("json", jsonSerializer{})
+	RegisterSerializer("msgpack", msgpackSerializer{})
+	RegisterSerializer("yaml", yamlSerializer{})
+}
+
+// RegisterSerializer registers serializer under given name such as kombu serializer name
+// and its content type, replacing serializer previously registered for them
+func RegisterSerializer(name string, serializer Serializer) {
+	serializersLock.Lock()
+	defer serializersLock.Unlock()
+	serializers[serializer.ContentType()] = serializer
+	serializerNames[name] = serializer.ContentType()
+}
+
+// GetSerializer returns serializer registered under given name or content type
+func GetSerializer(name string) (Serializer, error) {
+	serializersLock.RLock()
+	defer serializersLock.RUnlock()
+	contentType, ok := serializerNames[name]
+	if !ok {
+		contentType = name
+	}
+	serializer, ok := serializers[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported serializer %s", name)
+	}
+	return serializer, nil
+}
+
+// brokerSerializers holds serializers of task messages set up by client of broker,
+// such as auth serializer, which are not registered globally.
+// It is embedded in brokers, so that clients with different keys do not share serializers.
+type brokerSerializers struct {
+	serializersLock sync.RWMutex
+	serializers     map[string]Serializer
+}
+
+// serializingBroker is broker decoding task messages with serializers set up by client
+type serializingBroker interface {
+	CeleryBroker
+	setSerializer(serializer Serializer)
+}
+
+// setSerializer sets serializer decoding task messages of its content type
+func (s *brokerSerializers) setSerializer(serializer Serializer) {
+	s.serializersLock.Lock()
+	defer s.serializersLock.Unlock()
+	if s.serializers == nil {
+		s.serializers = map[string]Serializer{}
+	}
+	s.serializers[serializer.ContentType()] = serializer
+}
+
+// getSerializer returns serializer of content type set up for broker or registered globally
+func (s *brokerSerializers) getSerializer(contentType string) (Serializer, error) {
+	s.serializersLock.RLock()
+	serializer, ok := s.serializers[contentType]
+	s.serializersLock.RUnlock()
+	if ok {
+		return serializer, nil
+	}
+	return GetSerializer(contentType)
+}
+
+// decodeTaskMessage decodes task message of celery message with serializers of broker
+func (s *brokerSerializers) decodeTaskMessage(message *CeleryMessage) *TaskMessage {
+	return message.decodeTaskMessage(s.getSerializer)
+}
+
+// inspectTaskMessage calls fn with task message of celery message being sent.
+// Task message of client is used as is, other messages are decoded and released afterwards.
+func (s *brokerSerializers) inspectTaskMessage(message *CeleryMessage, fn func(*TaskMessage)) error {
+	if message.taskMessage != nil {
+		fn(message.taskMessage)
+		return nil
+	}
+	taskMessage := s.decodeTaskMessage(message)
+	if taskMessage == nil {
+		return fmt.Errorf("failed to decode task message")
+	}
+	defer releaseTaskMessage(taskMessage)
+	fn(taskMessage)
+	return nil
+}
+
+// BrokerSerializers holds serializers of task messages set up by client of broker.
+// It is embedded in brokers of other packages, so that CeleryClient.SetupSecurity
+// and CeleryClient.SetEncryption set up serializers decoding their task messages.
+type BrokerSerializers struct {
+	brokerSerializers
+}
+
+// DecodeTaskMessage decodes task message of celery message with serializers of broker.
+// It returns nil if task message cannot be decoded.
+func (s *BrokerSerializers) DecodeTaskMessage(message *CeleryMessage) *TaskMessage {
+	return s.decodeTaskMessage(message)
+}
+
+// InspectTaskMessage calls fn with task message of celery message being sent
+func (s *BrokerSerializers) InspectTaskMessage(message *CeleryMessage, fn func(*TaskMessage)) error {
+	return s.inspectTaskMessage(message, fn)
+}
+
+// jsonSerializer is default serializer compatible with kombu json serializer
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string {
+	return "application/json"
+}
+
+func (jsonSerializer) ContentEncoding() string {
+	return "utf-8"
+}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackSerializer is compatible with kombu msgpack serializer.
+// Values are encoded with field names and types of their json encoding,
+// so that messages are the same regardless of serializer.
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) ContentType() string {
+	return "application/x-msgpack"
+}
+
+func (msgpackSerializer) ContentEncoding() string {
+	return "binary"
+}
+
+func (msgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	value, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(value)
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return fromJSONValue(value, v)
+}
+
+// yamlSerializer is compatible with kombu yaml serializer.
+// Values are encoded with field names and types of their json encoding,
+// so that messages are the same regardless of serializer.
+type yamlSerializer struct{}
+
+func (yamlSerializer) ContentType() string {
+	return "application/x-yaml"
+}
+
+func (yamlSerializer) ContentEncoding() string {
+	return "utf-8"
+}
+
+func (yamlSerializer) Marshal(v interface{}) ([]byte, error) {
+	value, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(value)
+}
+
+func (yamlSerializer) Unmarshal(data []byte, v interface{}) error {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return fromJSONValue(value, v)
+}
+
+// toJSONValue converts v to maps, slices and scalars of its json encoding.
+// Integral numbers are converted to int64 so that they are not encoded as floats.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertJSONNumbers(value), nil
+}
+
+func convertJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			if n, err := v.Int64(); err == nil {
+				return n
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// kombuTypes are types of values tagged by kombu json encoder
+// as {"__type__": "datetime", "__value__": "2021-03-04T05:06:07.123456"}
+var kombuTypes = map[string]bool{
+	"bytes":    true,
+	"datetime": true,
+	"date":     true,
+	"time":     true,
+	"decimal":  true,
+	"uuid":     true,
+}
+
+// unwrapKombuTypes replaces values tagged by kombu json encoder with their string values.
+// Datetimes are formatted in RFC 3339 format, so that they are decoded into nested time.Time values,
+// naive datetimes are considered to be in UTC. Maps and slices are modified in place.
+func unwrapKombuTypes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if typ, ok := v["__type__"].(string); ok && len(v) == 2 && kombuTypes[typ] {
+			if s, ok := v["__value__"].(string); ok {
+				if typ == "datetime" {
+					if tm, err := parseTimeArgument(s); err == nil {
+						return tm.Format(time.RFC3339Nano)
+					}
+				}
+				return s
+			}
+		}
+		for key, item := range v {
+			v[key] = unwrapKombuTypes(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = unwrapKombuTypes(item)
+		}
+	}
+	return value
+}
+
+// fromJSONValue decodes value decoded by other serializer into v as if it was decoded from json,
+// so that numbers are decoded as float64 and map keys are strings
+func fromJSONValue(value interface{}, v interface{}) error {
+	data, err := json.Marshal(stringifyMapKeys(value))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func stringifyMapKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = stringifyMapKeys(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = stringifyMapKeys(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stringifyMapKeys(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestSerializerKombuMessages tests decoding of task messages serialized by kombu
+func TestSerializerKombuMessages(t *testing.T) {
+	testCases := []struct {
+		name            string
+		contentType     string
+		contentEncoding string
+		body            []byte
+	}{
+		{
+			name:            "json",
+			contentType:     "application/json",
+			contentEncoding: "utf-8",
+			body:            []byte(`{"id": "x", "task": "add", "args": [1, 2], "kwargs": {}}`),
+		},
+		{
+			// msgpack.packb({"id": "x", "task": "add", "args": [1, 2], "kwargs": {}}, use_bin_type=True)
+			name:            "msgpack",
+			contentType:     "application/x-msgpack",
+			contentEncoding: "binary",
+			body: []byte("\x84\xa2id\xa1x\xa4task\xa3add" +
+				"\xa4args\x92\x01\x02\xa6kwargs\x80"),
+		},
+		{
+			// yaml.safe_dump({"id": "x", "task": "add", "args": [1, 2], "kwargs": {}})
+			name:            "yaml",
+			contentType:     "application/x-yaml",
+			contentEncoding: "utf-8",
+			body:            []byte("args:\n- 1\n- 2\nid: x\nkwargs: {}\ntask: add\n"),
+		},
+	}
+	for _, tc := range testCases {
+		celeryMessage := getCeleryMessage(base64.StdEncoding.EncodeToString(tc.body))
+		celeryMessage.ContentType = tc.contentType
+		celeryMessage.ContentEncoding = tc.contentEncoding
+		taskMessage := celeryMessage.GetTaskMessage()
+		releaseCeleryMessage(celeryMessage)
+		if taskMessage == nil {
+			t.Errorf("test '%s': failed to decode task message", tc.name)
+			continue
+		}
+		if taskMessage.ID != "x" || taskMessage.Task != "add" {
+			t.Errorf("test '%s': received unexpected task message %+v", tc.name, taskMessage)
+		}
+		if !reflect.DeepEqual(taskMessage.Args, []interface{}{float64(1), float64(2)}) {
+			t.Errorf("test '%s': expected args decoded as json numbers but received %#v", tc.name, taskMessage.Args)
+		}
+		if taskMessage.contentType != tc.contentType {
+			t.Errorf("test '%s': expected content type %s but received %s", tc.name, tc.contentType, taskMessage.contentType)
+		}
+		releaseTaskMessage(taskMessage)
+	}
+}
+
+// TestSerializerRoundTrip tests that task messages keep integers and field names of json encoding
+func TestSerializerRoundTrip(t *testing.T) {
+	for _, name := range []string{"json", "msgpack", "yaml", "application/x-msgpack"} {
+		serializer, err := GetSerializer(name)
+		if err != nil {
+			t.Errorf("test '%s': failed to get serializer: %v", name, err)
+			continue
+		}
+		expires := time.Now().UTC().Truncate(time.Second)
+		taskMessage := getTaskMessage("add")
+		taskMessage.Args = []interface{}{1, 2.5, "three"}
+		taskMessage.Kwargs = map[string]interface{}{"nested": map[string]interface{}{"a": []int{1}}}
+		taskMessage.Expires = &expires
+		encoded, err := taskMessage.EncodeWithSerializer(serializer)
+		taskID := taskMessage.ID
+		releaseTaskMessage(taskMessage)
+		if err != nil {
+			t.Errorf("test '%s': failed to encode task message: %v", name, err)
+			continue
+		}
+		decoded, err := DecodeTaskMessageWithSerializer(encoded, serializer)
+		if err != nil {
+			t.Errorf("test '%s': failed to decode task message: %v", name, err)
+			continue
+		}
+		if decoded.ID != taskID || decoded.Expires == nil || !decoded.Expires.Equal(expires) {
+			t.Errorf("test '%s': received unexpected task message %+v", name, decoded)
+		}
+		if !reflect.DeepEqual(decoded.Args, []interface{}{float64(1), 2.5, "three"}) {
+			t.Errorf("test '%s': received unexpected args %#v", name, decoded.Args)
+		}
+		if !reflect.DeepEqual(decoded.Kwargs["nested"], map[string]interface{}{"a": []interface{}{float64(1)}}) {
+			t.Errorf("test '%s': received unexpected kwargs %#v", name, decoded.Kwargs)
+		}
+		releaseTaskMessage(decoded)
+	}
+	// integers are not encoded as floats for python workers
+	value, err := toJSONValue([]interface{}{1, 2.5})
+	if err != nil {
+		t.Fatalf("failed to convert value: %v", err)
+	}
+	if !reflect.DeepEqual(value, []interface{}{int64(1), 2.5}) {
+		t.Errorf("expected integer to be kept but received %#v", value)
+	}
+	if _, err := GetSerializer("pickle"); err == nil {
+		t.Errorf("expected unregistered serializer to be rejected")
+	}
+}
+
+// TestSerializerAcceptContent tests sending tasks with msgpack and rejection of content types not accepted by worker
+func TestSerializerAcceptContent(t *testing.T) {
+	broker := NewMemoryBroker()
+	backend := NewMemoryBackend()
+	client, _ := NewCeleryClient(broker, backend, 1)
+	if err := client.SetSerializer("msgpack"); err != nil {
+		t.Fatalf("failed to set serializer: %v", err)
+	}
+	taskName := uuid.Must(uuid.NewV4()).String()
+	client.Register(taskName, add)
+
+	// json only worker refuses msgpack message
+	if _, err := client.Delay(taskName, 1, 2); err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	taskMessage, err := broker.GetTaskMessage()
+	if err != nil || taskMessage == nil {
+		t.Fatalf("failed to get task message: %v", err)
+	}
+	if _, err := client.worker.RunTask(taskMessage); err == nil {
+		t.Errorf("expected msgpack task message to be refused by json only worker")
+	}
+
+	if err := client.SetAcceptContent("json", "msgpack"); err != nil {
+		t.Fatalf("failed to set accepted content: %v", err)
+	}
+	asyncResult, err := client.Delay(taskName, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartWorkerWithContext(ctx)
+	defer client.StopWorker()
+	res, err := asyncResult.Get(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if fmt.Sprint(res) != "3" {
+		t.Errorf("expected result 3 but received %v", res)
+	}
+	if err := client.SetAcceptContent("pickle"); err == nil {
+		t.Errorf("expected unregistered serializer to be rejected")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqlDialect stores database specific sql syntax
+type sqlDialect struct {
+	name        string
+	idColumn    string
+	binaryType  string
+	timeType    string
+	numbered    bool
+	createTable string
+	onConflict  string
+	assignment  string
+	skipLocked  bool
+	createIndex string
+}
+
+var sqlDialects = map[string]*sqlDialect{
+	"sqlite": {
+		name:        "sqlite",
+		idColumn:    "INTEGER PRIMARY KEY AUTOINCREMENT",
+		binaryType:  "BLOB",
+		timeType:    "DATETIME",
+		createTable: "CREATE TABLE IF NOT EXISTS",
+		onConflict:  "ON CONFLICT (%s) DO UPDATE SET",
+		assignment:  "%[1]s = excluded.%[1]s",
+		createIndex: "CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+	},
+	"postgres": {
+		name:        "postgres",
+		idColumn:    "SERIAL PRIMARY KEY",
+		binaryType:  "BYTEA",
+		timeType:    "TIMESTAMP",
+		numbered:    true,
+		createTable: "CREATE TABLE IF NOT EXISTS",
+		onConflict:  "ON CONFLICT (%s) DO UPDATE SET",
+		assignment:  "%[1]s = excluded.%[1]s",
+		skipLocked:  true,
+		createIndex: "CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+	},
+	"mysql": {
+		name:        "mysql",
+		idColumn:    "INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		binaryType:  "BLOB",
+		timeType:    "DATETIME",
+		createTable: "CREATE TABLE IF NOT EXISTS",
+		onConflict:  "ON DUPLICATE KEY UPDATE",
+		assignment:  "%[1]s = VALUES(%[1]s)",
+		skipLocked:  true,
+	},
+}
+
+// sqlDriverDialects maps database/sql driver names to dialects
+var sqlDriverDialects = map[string]string{
+	"sqlite":   "sqlite",
+	"sqlite3":  "sqlite",
+	"postgres": "postgres",
+	"pgx":      "postgres",
+	"mysql":    "mysql",
+}
+
+// newSQLDialect returns dialect of given database/sql driver name
+func newSQLDialect(driverName string) (*sqlDialect, error) {
+	name, ok := sqlDriverDialects[driverName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sql driver %s", driverName)
+	}
+	return sqlDialects[name], nil
+}
+
+// rebind replaces ? placeholders with numbered placeholders when required by dialect
+func (d *sqlDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// upsert returns query inserting row or updating columns of existing row with the same key
+func (d *sqlDialect) upsert(table, key string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)+1), ", ")
+	onConflict := d.onConflict
+	if strings.Contains(onConflict, "%s") {
+		onConflict = fmt.Sprintf(onConflict, key)
+	}
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = fmt.Sprintf(d.assignment, column)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (%s) %s %s", table, key, strings.Join(columns, ", "), placeholders, onConflict, strings.Join(updates, ", "))
+	return d.rebind(query)
+}
+
+// migrateSQLTable creates table if it does not exist and adds missing columns to existing table
+func migrateSQLTable(db *sql.DB, d *sqlDialect, table string, columns []string) error {
+	query := fmt.Sprintf("%s %s (id %s, %s)", d.createTable, table, d.idColumn, strings.Join(columns, ", "))
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create table %s: %v", table, err)
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return err
+	}
+	existing, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	existingSet := map[string]bool{}
+	for _, column := range existing {
+		existingSet[strings.ToLower(column)] = true
+	}
+	for _, column := range columns {
+		name := strings.Fields(column)[0]
+		if existingSet[name] {
+			continue
+		}
+		// unique constraint cannot be added with column in sqlite
+		definition := strings.Replace(column, " UNIQUE", "", 1)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, definition)); err != nil {
+			return fmt.Errorf("failed to add column %s to table %s: %v", name, table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLCeleryBackend is celery backend for sql databases.
+// Results are stored in celery_taskmeta and celery_tasksetmeta tables
+// using the schema and pickle encoding of celery database result backend,
+// so that results can be shared with python celery.
+// Only json-compatible results of python tasks can be read,
+// pickled python objects such as datetime and Decimal are rejected.
+type SQLCeleryBackend struct {
+	DB         *sql.DB
+	TaskTable  string
+	GroupTable string
+	// Expires is age of results removed by Cleanup
+	Expires time.Duration
+	dialect *sqlDialect
+}
+
+// NewSQLBackend creates new SQLCeleryBackend with given database handle.
+// driverName is name of database/sql driver used to open db such as sqlite3, postgres or mysql.
+func NewSQLBackend(db *sql.DB, driverName string) (*SQLCeleryBackend, error) {
+	dialect, err := newSQLDialect(driverName)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLCeleryBackend{
+		DB:         db,
+		TaskTable:  "celery_taskmeta",
+		GroupTable: "celery_tasksetmeta",
+		Expires:    24 * time.Hour,
+		dialect:    dialect,
+	}, nil
+}
+
+// Migrate creates result tables if they do not exist and adds columns
+// introduced by newer celery versions to existing tables
+func (b *SQLCeleryBackend) Migrate() error {
+	d := b.dialect
+	taskColumns := []string{
+		"task_id VARCHAR(155) UNIQUE",
+		"status VARCHAR(50)",
+		"result " + d.binaryType,
+		"date_done " + d.timeType,
+		"traceback TEXT",
+		"name VARCHAR(155)",
+		"args " + d.binaryType,
+		"kwargs " + d.binaryType,
+		"worker VARCHAR(155)",
+		"retries INTEGER",
+		"queue VARCHAR(155)",
+	}
+	groupColumns := []string{
+		"taskset_id VARCHAR(155) UNIQUE",
+		"result " + d.binaryType,
+		"date_done " + d.timeType,
+	}
+	if err := migrateSQLTable(b.DB, d, b.TaskTable, taskColumns); err != nil {
+		return err
+	}
+	return migrateSQLTable(b.DB, d, b.GroupTable, groupColumns)
+}
+
+// GetResult retrieves result from sql database
+func (b *SQLCeleryBackend) GetResult(taskID string) (*ResultMessage, error) {
+	query := b.dialect.rebind(fmt.Sprintf("SELECT status, result, traceback, date_done FROM %s WHERE task_id = ?", b.TaskTable))
+	var status sql.NullString
+	var result []byte
+	var traceback sql.NullString
+	var dateDone interface{}
+	err := b.DB.QueryRow(query, taskID).Scan(&status, &result, &traceback, &dateDone)
+	if err == sql.ErrNoRows {
+		return nil, ErrResultNotAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	resultMessage := &ResultMessage{
+		ID:     taskID,
+		Status: status.String,
+	}
+	if len(result) > 0 {
+		if resultMessage.Result, err = PickleLoads(result); err != nil {
+			return nil, err
+		}
+	}
+	if traceback.Valid {
+		resultMessage.Traceback = traceback.String
+	}
+	// drivers return date_done as time or as text depending on column type
+	switch v := dateDone.(type) {
+	case time.Time:
+		resultMessage.DateDone = v.UTC().Format(CeleryTimeLayout)
+	case []byte:
+		resultMessage.DateDone = string(v)
+	case string:
+		resultMessage.DateDone = v
+	}
+	return resultMessage, nil
+}
+
+// SetResult stores result in sql database
+func (b *SQLCeleryBackend) SetResult(taskID string, result *ResultMessage) error {
+	resBytes, err := pickleDumps(result.Result)
+	if err != nil {
+		return err
+	}
+	var traceback interface{}
+	if result.Traceback != nil {
+		traceback = fmt.Sprint(result.Traceback)
+	}
+	query := b.dialect.upsert(b.TaskTable, "task_id", []string{"status", "result", "traceback", "date_done"})
+	_, err = b.DB.Exec(query, taskID, result.Status, resBytes, traceback, ResultDateDone(result))
+	return err
+}
+
+// ForgetResult removes result from sql database
+func (b *SQLCeleryBackend) ForgetResult(taskID string) error {
+	query := b.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE task_id = ?", b.TaskTable))
+	_, err := b.DB.Exec(query, taskID)
+	return err
+}
+
+// SaveGroup stores ids of tasks belonging to group in celery GroupResult format
+func (b *SQLCeleryBackend) SaveGroup(groupID string, taskIDs []string) error {
+	// python celery stores GroupResult.as_tuple()
+	results := make([]interface{}, len(taskIDs))
+	for i, taskID := range taskIDs {
+		results[i] = pickleTuple{pickleTuple{taskID, nil}, nil}
+	}
+	resBytes, err := pickleDumps(pickleTuple{pickleTuple{groupID, nil}, results})
+	if err != nil {
+		return err
+	}
+	query := b.dialect.upsert(b.GroupTable, "taskset_id", []string{"result", "date_done"})
+	_, err = b.DB.Exec(query, groupID, resBytes, time.Now().UTC())
+	return err
+}
+
+// GetGroup retrieves ids of tasks belonging to group
+func (b *SQLCeleryBackend) GetGroup(groupID string) ([]string, error) {
+	query := b.dialect.rebind(fmt.Sprintf("SELECT result FROM %s WHERE taskset_id = ?", b.GroupTable))
+	var result []byte
+	err := b.DB.QueryRow(query, groupID).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("group %s not available", groupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	val, err := PickleLoads(result)
+	if err != nil {
+		return nil, err
+	}
+	return groupTaskIDs(val)
+}
+
+// DeleteGroup removes group from sql database
+func (b *SQLCeleryBackend) DeleteGroup(groupID string) error {
+	query := b.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE taskset_id = ?", b.GroupTable))
+	_, err := b.DB.Exec(query, groupID)
+	return err
+}
+
+// Cleanup removes task and group results older than Expires
+// and returns number of removed rows
+func (b *SQLCeleryBackend) Cleanup() (int64, error) {
+	if b.Expires <= 0 {
+		return 0, nil
+	}
+	expired := time.Now().UTC().Add(-b.Expires)
+	var deleted int64
+	for _, table := range []string{b.TaskTable, b.GroupTable} {
+		query := b.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE date_done < ?", table))
+		res, err := b.DB.Exec(query, expired)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// groupTaskIDs extracts task ids from celery GroupResult tuple
+// ((group_id, parent), [((task_id, parent), children), ...])
+func groupTaskIDs(val interface{}) ([]string, error) {
+	group, ok := val.([]interface{})
+	if !ok || len(group) != 2 {
+		return nil, fmt.Errorf("malformed group result %v", val)
+	}
+	results, ok := group[1].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("malformed group result %v", val)
+	}
+	taskIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		resultTuple, ok := result.([]interface{})
+		if !ok || len(resultTuple) == 0 {
+			return nil, fmt.Errorf("malformed group member %v", result)
+		}
+		idTuple, ok := resultTuple[0].([]interface{})
+		if !ok || len(idTuple) == 0 {
+			return nil, fmt.Errorf("malformed group member %v", result)
+		}
+		taskID, ok := idTuple[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("malformed group member %v", result)
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, nil
+}
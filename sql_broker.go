@@ -0,0 +1,262 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SQLCeleryBroker is celery broker for sql databases.
+// Messages are stored in kombu_queue and kombu_message tables
+// compatible with kombu sqlalchemy transport.
+//
+// Messages are claimed with SELECT ... FOR UPDATE SKIP LOCKED on postgres and mysql.
+// Sqlite cannot lock rows, so messages are claimed with conditional update instead.
+// Claimed messages are deleted once acknowledged by worker.
+// Messages of workers crashed before acknowledging them are redelivered only if VisibilityTimeout is set.
+type SQLCeleryBroker struct {
+	DB           *sql.DB
+	QueueName    string
+	QueueTable   string
+	MessageTable string
+	// VisibilityTimeout is time after which claimed but unacknowledged messages are redelivered (0 disables redelivery).
+	// Python kombu never deletes consumed messages, so it must be disabled when python workers share the queue.
+	VisibilityTimeout time.Duration
+	dialect           *sqlDialect
+
+	queueLock sync.Mutex
+	queueID   int64
+	messages  sync.Map
+	brokerSerializers
+}
+
+// NewSQLBroker creates new SQLCeleryBroker with given database handle.
+// driverName is name of database/sql driver used to open db such as sqlite3, postgres or mysql.
+//
+// Redelivery is disabled by default like in kombu, so messages claimed by crashed workers are lost.
+// Setting VisibilityTimeout redelivers messages claimed longer ago than it,
+// which duplicates tasks running longer than VisibilityTimeout as claims are not extended,
+// and re-runs all messages consumed by python workers, which never delete them.
+// It should be enabled only for queues consumed by go workers running shorter tasks.
+func NewSQLBroker(db *sql.DB, driverName string) (*SQLCeleryBroker, error) {
+	dialect, err := newSQLDialect(driverName)
+	if err != nil {
+		return nil, err
+	}
+	broker := &SQLCeleryBroker{
+		DB:           db,
+		QueueName:    "celery",
+		QueueTable:   "kombu_queue",
+		MessageTable: "kombu_message",
+		dialect:      dialect,
+	}
+	return broker, nil
+}
+
+// Migrate creates queue and message tables if they do not exist
+func (b *SQLCeleryBroker) Migrate() error {
+	d := b.dialect
+	queueColumns := []string{
+		"name VARCHAR(200) UNIQUE",
+	}
+	messageColumns := []string{
+		"visible BOOLEAN",
+		"timestamp " + d.timeType,
+		"payload TEXT NOT NULL",
+		fmt.Sprintf("queue_id INTEGER REFERENCES %s (id)", b.QueueTable),
+		"version SMALLINT NOT NULL",
+	}
+	if err := migrateSQLTable(b.DB, d, b.QueueTable, queueColumns); err != nil {
+		return err
+	}
+	if err := migrateSQLTable(b.DB, d, b.MessageTable, messageColumns); err != nil {
+		return err
+	}
+	if d.createIndex == "" {
+		return nil
+	}
+	for _, column := range []string{"visible", "timestamp"} {
+		index := fmt.Sprintf("ix_%s_%s", b.MessageTable, column)
+		if _, err := b.DB.Exec(fmt.Sprintf(d.createIndex, index, b.MessageTable, column)); err != nil {
+			return fmt.Errorf("failed to create index %s: %v", index, err)
+		}
+	}
+	return nil
+}
+
+// SendCeleryMessage inserts CeleryMessage into message table
+func (b *SQLCeleryBroker) SendCeleryMessage(message *CeleryMessage) error {
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	queueID, err := b.getQueueID()
+	if err != nil {
+		return err
+	}
+	query := b.dialect.rebind(fmt.Sprintf("INSERT INTO %s (visible, timestamp, payload, queue_id, version) VALUES (?, ?, ?, ?, ?)", b.MessageTable))
+	_, err = b.DB.Exec(query, true, time.Now().UTC(), string(jsonBytes), queueID, 1)
+	return err
+}
+
+// GetCeleryMessage claims oldest visible celery message from message table
+func (b *SQLCeleryBroker) GetCeleryMessage() (int64, *CeleryMessage, error) {
+	queueID, err := b.getQueueID()
+	if err != nil {
+		return 0, nil, err
+	}
+	var messageID int64
+	var payload string
+	if b.dialect.skipLocked {
+		messageID, payload, err = b.claimLocked(queueID)
+	} else {
+		messageID, payload, err = b.claimConditional(queueID)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	var message CeleryMessage
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		// malformed message can never be processed
+		b.deleteMessage(messageID)
+		return 0, nil, err
+	}
+	return messageID, &message, nil
+}
+
+// GetTaskMessage retrieves task message from message table
+func (b *SQLCeleryBroker) GetTaskMessage() (*TaskMessage, error) {
+	messageID, celeryMessage, err := b.GetCeleryMessage()
+	if err != nil {
+		return nil, err
+	}
+	taskMessage := b.decodeTaskMessage(celeryMessage)
+	if taskMessage == nil {
+		b.deleteMessage(messageID)
+		return nil, fmt.Errorf("failed to decode task message of message %d", messageID)
+	}
+	b.messages.Store(taskMessage.ID, messageID)
+	return taskMessage, nil
+}
+
+// AckTaskMessage deletes message of executed task from message table
+func (b *SQLCeleryBroker) AckTaskMessage(message *TaskMessage) error {
+	messageID, ok := b.messages.Load(message.ID)
+	if !ok {
+		return fmt.Errorf("no claimed message for task %s", message.ID)
+	}
+	if err := b.deleteMessage(messageID.(int64)); err != nil {
+		return err
+	}
+	b.messages.Delete(message.ID)
+	return nil
+}
+
+// visibleCondition returns condition selecting messages that can be claimed
+func (b *SQLCeleryBroker) visibleCondition() (string, []interface{}) {
+	if b.VisibilityTimeout <= 0 {
+		return "visible = ?", []interface{}{true}
+	}
+	expired := time.Now().UTC().Add(-b.VisibilityTimeout)
+	return "(visible = ? OR timestamp < ?)", []interface{}{true, expired}
+}
+
+// claimLocked claims message within transaction skipping rows locked by other workers
+func (b *SQLCeleryBroker) claimLocked(queueID int64) (int64, string, error) {
+	tx, err := b.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+	condition, args := b.visibleCondition()
+	query := b.dialect.rebind(fmt.Sprintf(
+		"SELECT id, payload FROM %s WHERE queue_id = ? AND %s ORDER BY timestamp, id LIMIT 1 FOR UPDATE SKIP LOCKED",
+		b.MessageTable, condition,
+	))
+	var messageID int64
+	var payload string
+	err = tx.QueryRow(query, append([]interface{}{queueID}, args...)...).Scan(&messageID, &payload)
+	if err == sql.ErrNoRows {
+		return 0, "", fmt.Errorf("sql queue %s is empty", b.QueueName)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	update := b.dialect.rebind(fmt.Sprintf("UPDATE %s SET visible = ?, timestamp = ? WHERE id = ?", b.MessageTable))
+	if _, err := tx.Exec(update, false, time.Now().UTC(), messageID); err != nil {
+		return 0, "", err
+	}
+	return messageID, payload, tx.Commit()
+}
+
+// claimConditional claims message by updating it only if it is still visible.
+// Claim is retried when other worker claimed the same message first.
+func (b *SQLCeleryBroker) claimConditional(queueID int64) (int64, string, error) {
+	for retry := 0; retry < 3; retry++ {
+		condition, args := b.visibleCondition()
+		query := b.dialect.rebind(fmt.Sprintf(
+			"SELECT id, payload FROM %s WHERE queue_id = ? AND %s ORDER BY timestamp, id LIMIT 1",
+			b.MessageTable, condition,
+		))
+		var messageID int64
+		var payload string
+		err := b.DB.QueryRow(query, append([]interface{}{queueID}, args...)...).Scan(&messageID, &payload)
+		if err == sql.ErrNoRows {
+			return 0, "", fmt.Errorf("sql queue %s is empty", b.QueueName)
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		update := b.dialect.rebind(fmt.Sprintf("UPDATE %s SET visible = ?, timestamp = ? WHERE id = ? AND %s", b.MessageTable, condition))
+		res, err := b.DB.Exec(update, append([]interface{}{false, time.Now().UTC(), messageID}, args...)...)
+		if err != nil {
+			return 0, "", err
+		}
+		claimed, err := res.RowsAffected()
+		if err != nil {
+			return 0, "", err
+		}
+		if claimed == 1 {
+			return messageID, payload, nil
+		}
+	}
+	return 0, "", fmt.Errorf("failed to claim message from sql queue %s", b.QueueName)
+}
+
+func (b *SQLCeleryBroker) deleteMessage(messageID int64) error {
+	query := b.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE id = ?", b.MessageTable))
+	_, err := b.DB.Exec(query, messageID)
+	return err
+}
+
+// getQueueID returns id of queue row creating it if necessary
+func (b *SQLCeleryBroker) getQueueID() (int64, error) {
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+	if b.queueID != 0 {
+		return b.queueID, nil
+	}
+	query := b.dialect.rebind(fmt.Sprintf("SELECT id FROM %s WHERE name = ?", b.QueueTable))
+	err := b.DB.QueryRow(query, b.QueueName).Scan(&b.queueID)
+	if err == sql.ErrNoRows {
+		insert := b.dialect.rebind(fmt.Sprintf("INSERT INTO %s (name) VALUES (?)", b.QueueTable))
+		if _, err := b.DB.Exec(insert, b.QueueName); err != nil {
+			// queue may have been created concurrently
+			if err := b.DB.QueryRow(query, b.QueueName).Scan(&b.queueID); err != nil {
+				return 0, err
+			}
+			return b.queueID, nil
+		}
+		err = b.DB.QueryRow(query, b.QueueName).Scan(&b.queueID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return b.queueID, nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Task is typed celery task shared by producers and workers.
+// Fields of Args struct are sent as keyword arguments named by their json tags,
+// so that python clients call it with apply_async(kwargs=...).
+type Task[Args any, Result any] struct {
+	Name string
+	fn   func(Args) (Result, error)
+	cc   *CeleryClient
+}
+
+// NewTask creates typed task with given name executing fn.
+// fn may be nil for tasks only sent by producers.
+// It panics if Args is not struct or map with string keys.
+func NewTask[Args any, Result any](name string, fn func(Args) (Result, error)) *Task[Args, Result] {
+	argsType := reflect.TypeOf((*Args)(nil)).Elem()
+	for argsType.Kind() == reflect.Ptr {
+		argsType = argsType.Elem()
+	}
+	isStringMap := argsType.Kind() == reflect.Map && argsType.Key().Kind() == reflect.String
+	if argsType.Kind() != reflect.Struct && !isStringMap {
+		panic(fmt.Sprintf("gocelery: arguments of task %s must be struct or map with string keys, not %s", name, argsType))
+	}
+	return &Task[Args, Result]{
+		Name: name,
+		fn:   fn,
+	}
+}
+
+// Register binds task to client, so that Delay sends it with client
+// and workers of client execute it
+func (t *Task[Args, Result]) Register(cc *CeleryClient) {
+	t.cc = cc
+	if t.fn != nil {
+		cc.Register(t.Name, t)
+	}
+}
+
+// Delay sends task with given arguments using client task is registered with
+func (t *Task[Args, Result]) Delay(ctx context.Context, args Args) (*TypedAsyncResult[Result], error) {
+	if t.cc == nil {
+		return nil, fmt.Errorf("task %s is not registered with client", t.Name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	kwargs, err := encodeTaskKwargs(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode arguments of task %s: %v", t.Name, err)
+	}
+	asyncResult, err := t.cc.DelayKwargs(t.Name, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedAsyncResult[Result]{AsyncResult: asyncResult}, nil
+}
+
+// runTaskMessage decodes keyword arguments of task message and executes task
+func (t *Task[Args, Result]) runTaskMessage(message *TaskMessage) (*ResultMessage, error) {
+	if len(message.Args) > 0 {
+		return nil, &taskError{excType: "TypeError", err: fmt.Errorf("task %s accepts keyword arguments only", t.Name)}
+	}
+	var args Args
+	if err := decodeTaskKwargs(message.Kwargs, &args); err != nil {
+		return nil, &taskError{excType: "TypeError", err: fmt.Errorf("failed to decode arguments of task %s: %v", t.Name, err)}
+	}
+	val, err := t.fn(args)
+	if err != nil {
+		return nil, &taskError{err: err}
+	}
+	return getTaskResultMessage(val)
+}
+
+// taskMessageRunner is implemented by tasks decoding task messages themselves
+type taskMessageRunner interface {
+	runTaskMessage(*TaskMessage) (*ResultMessage, error)
+}
+
+// encodeTaskKwargs encodes struct or map as keyword arguments using json field names
+func encodeTaskKwargs(args interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var kwargs map[string]interface{}
+	if err := json.Unmarshal(data, &kwargs); err != nil {
+		return nil, err
+	}
+	return kwargs, nil
+}
+
+// decodeTaskKwargs decodes keyword arguments into struct or map using json field names
+func decodeTaskKwargs(kwargs map[string]interface{}, args interface{}) error {
+	data, err := json.Marshal(kwargs)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, args)
+}
+
+// TypedAsyncResult is pending result of typed task
+type TypedAsyncResult[Result any] struct {
+	*AsyncResult
+}
+
+// Get gets result decoded as Result type.
+// It blocks for period of time set by timeout and returns error if unavailable
+func (ar *TypedAsyncResult[Result]) Get(timeout time.Duration) (Result, error) {
+	var result Result
+	val, err := ar.AsyncResult.Get(timeout)
+	if err != nil {
+		return result, err
+	}
+	err = decodeResultValue(val, &result)
+	return result, err
+}
+
+// GetContext gets result decoded as Result type polling backend until it is available or context is done
+func (ar *TypedAsyncResult[Result]) GetContext(ctx context.Context) (Result, error) {
+	var result Result
+	val, err := ar.AsyncResult.GetContext(ctx)
+	if err != nil {
+		return result, err
+	}
+	err = decodeResultValue(val, &result)
+	return result, err
+}
+
+// AsyncGet gets result decoded as Result type and returns error if not available
+func (ar *TypedAsyncResult[Result]) AsyncGet() (Result, error) {
+	var result Result
+	val, err := ar.AsyncResult.AsyncGet()
+	if err != nil {
+		return result, err
+	}
+	err = decodeResultValue(val, &result)
+	return result, err
+}
+
+// decodeResultValue decodes result value decoded from json into value pointed to by v
+// converting it like task arguments. Null results are decoded as zero values.
+func decodeResultValue(val interface{}, v interface{}) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("result must be decoded into non-nil pointer, not %T", v)
+	}
+	if val == nil {
+		ptr.Elem().Set(reflect.Zero(ptr.Elem().Type()))
+		return nil
+	}
+	// []byte results of go tasks are stored as base64 strings by encoding/json,
+	// while bytes of python tasks are kombu objects converted by ConvertArgument
+	t := ptr.Elem().Type()
+	if s, ok := val.(string); ok && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && t != rawMessageType {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("failed to decode result: %v", err)
+		}
+		ptr.Elem().Set(reflect.ValueOf(data).Convert(t))
+		return nil
+	}
+	converted, err := ConvertArgument(val, t)
+	if err != nil {
+		return fmt.Errorf("failed to decode result: %v", err)
+	}
+	ptr.Elem().Set(converted)
+	return nil
+}
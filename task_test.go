@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type greetArgs struct {
+	Name  string   `json:"name"`
+	Times int      `json:"times"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type greetResult struct {
+	Greeting string `json:"greeting"`
+	Length   int    `json:"length"`
+}
+
+func greet(args greetArgs) (greetResult, error) {
+	if args.Times <= 0 {
+		return greetResult{}, fmt.Errorf("times must be positive")
+	}
+	greeting := strings.Repeat("hello "+args.Name+" ", args.Times)
+	return greetResult{Greeting: greeting, Length: len(greeting)}, nil
+}
+
+// TestTaskTyped tests sending and executing typed tasks
+func TestTaskTyped(t *testing.T) {
+	broker := NewMemoryBroker()
+	client, _ := NewCeleryClient(broker, NewMemoryBackend(), 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	greetTask := NewTask(taskName, greet)
+	greetTask.Register(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartWorkerWithContext(ctx)
+	defer client.StopWorker()
+
+	asyncResult, err := greetTask.Delay(ctx, greetArgs{Name: "gopher", Times: 2})
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	res, err := asyncResult.Get(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	expected, _ := greet(greetArgs{Name: "gopher", Times: 2})
+	if res != expected {
+		t.Errorf("expected result %+v but received %+v", expected, res)
+	}
+
+	// kwargs sent by other clients are decoded by json field names
+	asyncRes, err := client.DelayKwargs(taskName, map[string]interface{}{"name": "python", "times": 1})
+	if err != nil {
+		t.Fatalf("failed to send task: %v", err)
+	}
+	typedResult := &TypedAsyncResult[greetResult]{AsyncResult: asyncRes}
+	res, err = typedResult.Get(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to get result: %v", err)
+	}
+	if res.Greeting != "hello python " {
+		t.Errorf("received unexpected result %+v", res)
+	}
+}
+
+// TestTaskTypedMalformed tests refusal of malformed typed task calls
+func TestTaskTypedMalformed(t *testing.T) {
+	client, _ := NewCeleryClient(NewMemoryBroker(), NewMemoryBackend(), 1)
+	taskName := uuid.Must(uuid.NewV4()).String()
+	producerTask := NewTask[greetArgs, greetResult](taskName, nil)
+	if _, err := producerTask.Delay(context.Background(), greetArgs{}); err == nil {
+		t.Errorf("expected unregistered task not to be sent")
+	}
+	producerTask.Register(client)
+	if client.worker.GetTask(taskName) != nil {
+		t.Errorf("expected producer only task not to be registered with worker")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := producerTask.Delay(ctx, greetArgs{}); err == nil {
+		t.Errorf("expected task not to be sent with cancelled context")
+	}
+
+	greetTask := NewTask(taskName, greet)
+	greetTask.Register(client)
+	testCases := []struct {
+		name    string
+		message *TaskMessage
+	}{
+		{
+			name:    "positional arguments",
+			message: &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{"gopher", 1}},
+		},
+		{
+			name: "mistyped keyword argument",
+			message: &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{},
+				Kwargs: map[string]interface{}{"name": "gopher", "times": "twice"}},
+		},
+		{
+			name: "task error",
+			message: &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{},
+				Kwargs: map[string]interface{}{"name": "gopher"}},
+		},
+	}
+	for _, tc := range testCases {
+		if _, err := client.worker.RunTask(tc.message); err == nil {
+			t.Errorf("test '%s': expected task to fail", tc.name)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected task with non-struct arguments to panic")
+		}
+	}()
+	NewTask(taskName, func(n int) (int, error) { return n, nil })
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Sick Yoon
+// This file is part of gocelery which is released under MIT license.
+// See file LICENSE for full license details.
+
+package gocelery
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// writeTestCertificate writes self-signed certificate and its private key to dir
+func writeTestCertificate(dir string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gocelery"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		return "", "", err
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// TestTLSConfig tests TLS configuration from files and url options
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocelery")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, err := writeTestCertificate(dir)
+	if err != nil {
+		t.Fatalf("failed to write test certificate: %v", err)
+	}
+
+	config, err := NewTLSConfig(certFile, keyFile, certFile, "rabbitmq.local")
+	if err != nil {
+		t.Fatalf("failed to create TLS config: %v", err)
+	}
+	if len(config.Certificates) != 1 || config.RootCAs == nil || config.ServerName != "rabbitmq.local" {
+		t.Errorf("TLS config is not fully configured: %+v", config)
+	}
+	if _, err := NewTLSConfig("", "", keyFile, ""); err == nil {
+		t.Errorf("expected error loading CA pool without certificates")
+	}
+
+	query := url.Values{
+		"ssl_certfile":  {certFile},
+		"ssl_keyfile":   {keyFile},
+		"ssl_cert_reqs": {"CERT_NONE"},
+	}
+	config, err = TLSConfigFromURL(query)
+	if err != nil {
+		t.Fatalf("failed to create TLS config from url: %v", err)
+	}
+	if len(config.Certificates) != 1 || !config.InsecureSkipVerify {
+		t.Errorf("TLS config from url is not fully configured: %+v", config)
+	}
+	if config, _ := TLSConfigFromURL(url.Values{}); config != nil {
+		t.Errorf("expected no TLS config without ssl options")
+	}
+	if _, err := TLSConfigFromURL(url.Values{"ssl_cert_reqs": {"SOMETIMES"}}); err == nil {
+		t.Errorf("expected error for invalid ssl_cert_reqs")
+	}
+
+	amqpConfig := amqp.Config{}
+	WithAMQPTLSConfig(config)(&amqpConfig)
+	WithAMQPExternalAuth()(&amqpConfig)
+	if amqpConfig.TLSClientConfig != config {
+		t.Errorf("expected TLS config to be set on amqp config")
+	}
+	if len(amqpConfig.SASL) != 1 || amqpConfig.SASL[0].Mechanism() != "EXTERNAL" {
+		t.Errorf("expected EXTERNAL SASL mechanism but received %+v", amqpConfig.SASL)
+	}
+
+	// options of url are kept separately from url used to reconnect
+	u, err := url.Parse("pyamqp://guest@rabbitmq.local:5671/?virtual_host=celery&login_method=EXTERNAL&ssl_cert_reqs=CERT_NONE")
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	dialURL, options, err := amqpDialFromURL(u, u.Query())
+	if err != nil {
+		t.Fatalf("failed to parse amqp url: %v", err)
+	}
+	if dialURL != "amqp://guest@rabbitmq.local:5671/" {
+		t.Errorf("expected url without query and python scheme but received %s", dialURL)
+	}
+	amqpConfig = amqp.Config{}
+	for _, option := range options {
+		option(&amqpConfig)
+	}
+	if amqpConfig.Vhost != "celery" || amqpConfig.TLSClientConfig == nil || !amqpConfig.TLSClientConfig.InsecureSkipVerify ||
+		len(amqpConfig.SASL) != 1 || amqpConfig.SASL[0].Mechanism() != "EXTERNAL" {
+		t.Errorf("amqp config from url is not fully configured: %+v", amqpConfig)
+	}
+}
@@ -6,8 +6,10 @@ package gocelery
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"reflect"
 	"sync"
 	"time"
@@ -19,10 +21,15 @@ type CeleryWorker struct {
 	backend         CeleryBackend
 	numWorkers      int
 	registeredTasks map[string]interface{}
+	taskOptions     map[string]*taskOptions
 	taskLock        sync.RWMutex
 	cancel          context.CancelFunc
 	workWG          sync.WaitGroup
 	rateLimitPeriod time.Duration
+	acceptContent   map[string]bool
+	trackStarted    bool
+	trackReceived   bool
+	hostname        string
 }
 
 // NewCeleryWorker returns new celery worker
@@ -32,7 +39,90 @@ func NewCeleryWorker(broker CeleryBroker, backend CeleryBackend, numWorkers int)
 		backend:         backend,
 		numWorkers:      numWorkers,
 		registeredTasks: map[string]interface{}{},
+		taskOptions:     map[string]*taskOptions{},
 		rateLimitPeriod: 100 * time.Millisecond,
+		acceptContent:   map[string]bool{"application/json": true},
+		hostname:        workerHostname(),
+	}
+}
+
+// workerHostname returns node name of worker in the same format as celery worker
+func workerHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return "celery@" + hostname
+}
+
+// SetTrackStarted enables reporting STARTED state of tasks like celery task_track_started setting.
+// Worker stores result with its hostname and pid before running task.
+// It is overridden for single task with WithTrackStarted.
+func (w *CeleryWorker) SetTrackStarted(enabled bool) {
+	w.taskLock.Lock()
+	w.trackStarted = enabled
+	w.taskLock.Unlock()
+}
+
+// SetTrackReceived enables reporting RECEIVED state of task messages fetched by worker.
+// Each worker then fetches next message while running task, so that it is RECEIVED until worker is free.
+func (w *CeleryWorker) SetTrackReceived(enabled bool) {
+	w.taskLock.Lock()
+	w.trackReceived = enabled
+	w.taskLock.Unlock()
+}
+
+// SetAcceptContent sets serializers of accepted task messages by registered name or content type
+// like celery accept_content setting. Only json is accepted by default.
+func (w *CeleryWorker) SetAcceptContent(names ...string) error {
+	acceptContent := map[string]bool{}
+	for _, name := range names {
+		serializer, err := GetSerializer(name)
+		if err != nil {
+			return err
+		}
+		acceptContent[serializer.ContentType()] = true
+	}
+	w.taskLock.Lock()
+	w.acceptContent = acceptContent
+	w.taskLock.Unlock()
+	return nil
+}
+
+// setAcceptContentTypes sets content types of accepted task messages
+// including serializers which are not registered globally
+func (w *CeleryWorker) setAcceptContentTypes(contentTypes ...string) {
+	acceptContent := map[string]bool{}
+	for _, contentType := range contentTypes {
+		acceptContent[contentType] = true
+	}
+	w.taskLock.Lock()
+	w.acceptContent = acceptContent
+	w.taskLock.Unlock()
+}
+
+// TaskOption configures task registered with worker
+type TaskOption func(*taskOptions)
+
+// taskOptions holds options of registered task
+type taskOptions struct {
+	argNames     []string
+	trackStarted *bool
+}
+
+// WithArgNames names parameters of function task, so that it accepts keyword arguments
+// like python function. Names must be given for all parameters including variadic one.
+func WithArgNames(names ...string) TaskOption {
+	return func(o *taskOptions) {
+		o.argNames = names
+	}
+}
+
+// WithTrackStarted enables or disables reporting STARTED state of task
+// regardless of SetTrackStarted of worker
+func WithTrackStarted(enabled bool) TaskOption {
+	return func(o *taskOptions) {
+		o.trackStarted = &enabled
 	}
 }
 
@@ -44,38 +134,180 @@ func (w *CeleryWorker) StartWorkerWithContext(ctx context.Context) {
 	for i := 0; i < w.numWorkers; i++ {
 		go func(workerID int) {
 			defer w.workWG.Done()
+			if broker, ok := w.broker.(CeleryBlockingBroker); ok {
+				w.processTaskMessages(wctx, func() *TaskMessage {
+					return w.receiveTaskMessage(wctx, broker)
+				})
+				return
+			}
 			ticker := time.NewTicker(w.rateLimitPeriod)
-			for {
+			defer ticker.Stop()
+			w.processTaskMessages(wctx, func() *TaskMessage {
 				select {
 				case <-wctx.Done():
-					return
+					return nil
 				case <-ticker.C:
-					// process task request
-					taskMessage, err := w.broker.GetTaskMessage()
-					if err != nil || taskMessage == nil {
-						continue
-					}
-
-					// run task
-					resultMsg, err := w.RunTask(taskMessage)
-					if err != nil {
-						log.Printf("failed to run task message %s: %+v", taskMessage.ID, err)
-						continue
-					}
-					defer releaseResultMessage(resultMsg)
-
-					// push result to backend
-					err = w.backend.SetResult(taskMessage.ID, resultMsg)
-					if err != nil {
-						log.Printf("failed to push result: %+v", err)
-						continue
-					}
 				}
-			}
+				// process task request
+				taskMessage, err := w.broker.GetTaskMessage()
+				if err != nil {
+					return nil
+				}
+				return taskMessage
+			})
 		}(i)
 	}
 }
 
+// processTaskMessages runs tasks of messages returned by fetch until context is done.
+// When RECEIVED state is tracked, next message is fetched and reported while task is running
+// like messages prefetched by celery workers, otherwise messages are fetched only by idle worker.
+// Fetched message is run even if context is done meanwhile, so that it is not lost.
+func (w *CeleryWorker) processTaskMessages(ctx context.Context, fetch func() *TaskMessage) {
+	messages := make(chan *TaskMessage)
+	idle := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case idle <- struct{}{}:
+			default:
+			}
+			taskMessage, ok := <-messages
+			if !ok {
+				return
+			}
+			w.processTaskMessage(taskMessage)
+		}
+	}()
+	defer func() {
+		close(messages)
+		<-done
+	}()
+	waiting := false // task runner is known to wait for message
+	for {
+		if !waiting && !w.tracksReceived() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-idle:
+				waiting = true
+			}
+		}
+		taskMessage := fetch()
+		if taskMessage == nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if w.tracksReceived() {
+			w.setTaskState(taskMessage.ID, StateReceived, nil)
+		}
+		messages <- taskMessage
+		waiting = false
+		// discard signal sent by runner before it received message
+		select {
+		case <-idle:
+		default:
+		}
+	}
+}
+
+// receiveTaskMessage waits for task message of blocking broker.
+// It returns nil if context is done or broker failed.
+func (w *CeleryWorker) receiveTaskMessage(ctx context.Context, broker CeleryBlockingBroker) *TaskMessage {
+	taskMessage, err := broker.GetTaskMessageWithContext(ctx)
+	if ctx.Err() != nil {
+		return taskMessage
+	}
+	if err != nil {
+		// avoid busy loop while broker is unavailable
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.rateLimitPeriod):
+		}
+		return nil
+	}
+	return taskMessage
+}
+
+// processTaskMessage runs task and pushes its result to backend
+func (w *CeleryWorker) processTaskMessage(taskMessage *TaskMessage) {
+	// run task
+	task, err := w.getMessageTask(taskMessage)
+	var resultMsg *ResultMessage
+	if err == nil {
+		w.reportStarted(taskMessage)
+		resultMsg, err = w.runTask(task, taskMessage)
+	}
+	if err != nil {
+		// errors of task itself are stored as FAILURE results
+		var taskErr *taskError
+		if !errors.As(err, &taskErr) {
+			log.Printf("failed to run task message %s: %+v", taskMessage.ID, err)
+			w.ackTaskMessage(taskMessage)
+			return
+		}
+		resultMsg = getFailureResultMessage(err)
+	}
+	defer releaseResultMessage(resultMsg)
+	resultMsg.DateDone = time.Now().UTC().Format(CeleryTimeLayout)
+
+	// push result to backend
+	err = w.resultBackend().SetResult(taskMessage.ID, resultMsg)
+	if err != nil {
+		log.Printf("failed to push result: %+v", err)
+		return
+	}
+	w.ackTaskMessage(taskMessage)
+}
+
+// tracksReceived checks if RECEIVED state of tasks is reported
+func (w *CeleryWorker) tracksReceived() bool {
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	return w.trackReceived
+}
+
+// reportStarted stores STARTED state of task if it is tracked
+func (w *CeleryWorker) reportStarted(message *TaskMessage) {
+	w.taskLock.RLock()
+	trackStarted := w.trackStarted
+	w.taskLock.RUnlock()
+	if opts := w.getTaskOptions(message.Task); opts.trackStarted != nil {
+		trackStarted = *opts.trackStarted
+	}
+	if trackStarted {
+		w.setTaskState(message.ID, StateStarted, map[string]interface{}{
+			"hostname": w.hostname,
+			"pid":      os.Getpid(),
+		})
+	}
+}
+
+// setTaskState stores state of running task with given metadata
+func (w *CeleryWorker) setTaskState(taskID string, state string, meta interface{}) {
+	resultMsg := getResultMessage(meta)
+	defer releaseResultMessage(resultMsg)
+	resultMsg.Status = state
+	if err := w.resultBackend().SetResult(taskID, resultMsg); err != nil {
+		log.Printf("failed to push %s state of task %s: %+v", state, taskID, err)
+	}
+}
+
+// ackTaskMessage acknowledges task message if broker supports late acknowledgement
+func (w *CeleryWorker) ackTaskMessage(message *TaskMessage) {
+	broker, ok := w.broker.(CeleryAcksLateBroker)
+	if !ok {
+		return
+	}
+	if err := broker.AckTaskMessage(message); err != nil {
+		log.Printf("failed to acknowledge task message %s: %+v", message.ID, err)
+	}
+}
+
 // StartWorker starts celery workers
 func (w *CeleryWorker) StartWorker() {
 	w.StartWorkerWithContext(context.Background())
@@ -98,12 +330,45 @@ func (w *CeleryWorker) GetNumWorkers() int {
 }
 
 // Register registers tasks (functions)
-func (w *CeleryWorker) Register(name string, task interface{}) {
+// It panics if task is neither CeleryTask nor function with arguments and results sent as json
+func (w *CeleryWorker) Register(name string, task interface{}, options ...TaskOption) {
+	opts := &taskOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	switch task.(type) {
+	case CeleryTask, taskMessageRunner:
+	default:
+		taskType := reflect.TypeOf(task)
+		if taskType == nil || taskType.Kind() != reflect.Func {
+			panic(fmt.Sprintf("gocelery: task %s must be function or CeleryTask, not %v", name, taskType))
+		}
+		if err := validateTaskFunc(taskType); err != nil {
+			panic(fmt.Sprintf("gocelery: invalid function of task %s: %v", name, err))
+		}
+	}
+	if opts.argNames != nil {
+		taskType := reflect.TypeOf(task)
+		if taskType == nil || taskType.Kind() != reflect.Func || taskType.NumIn() != len(opts.argNames) {
+			panic(fmt.Sprintf("gocelery: %d argument names given for task %s of type %v", len(opts.argNames), name, taskType))
+		}
+	}
 	w.taskLock.Lock()
 	w.registeredTasks[name] = task
+	w.taskOptions[name] = opts
 	w.taskLock.Unlock()
 }
 
+// getTaskOptions retrieves options of registered task
+func (w *CeleryWorker) getTaskOptions(name string) *taskOptions {
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	if opts, ok := w.taskOptions[name]; ok {
+		return opts
+	}
+	return &taskOptions{}
+}
+
 // GetTask retrieves registered task
 func (w *CeleryWorker) GetTask(name string) interface{} {
 	w.taskLock.RLock()
@@ -118,12 +383,26 @@ func (w *CeleryWorker) GetTask(name string) interface{} {
 
 // RunTask runs celery task
 func (w *CeleryWorker) RunTask(message *TaskMessage) (*ResultMessage, error) {
+	task, err := w.getMessageTask(message)
+	if err != nil {
+		return nil, err
+	}
+	return w.runTask(task, message)
+}
+
+// getMessageTask retrieves registered task of message which is accepted by worker
+func (w *CeleryWorker) getMessageTask(message *TaskMessage) (interface{}, error) {
 
 	// ignore if the message is expired
 	if message.Expires != nil && message.Expires.UTC().Before(time.Now().UTC()) {
 		return nil, fmt.Errorf("task %s is expired on %s", message.ID, message.Expires)
 	}
 
+	// refuse content types not accepted by worker
+	if !w.acceptsContent(message.contentType) {
+		return nil, fmt.Errorf("task %s has content type %s not accepted by worker", message.ID, message.contentType)
+	}
+
 	// check for malformed task message - args cannot be nil
 	if message.Args == nil {
 		return nil, fmt.Errorf("task %s is malformed - args cannot be nil", message.ID)
@@ -134,56 +413,153 @@ func (w *CeleryWorker) RunTask(message *TaskMessage) (*ResultMessage, error) {
 	if task == nil {
 		return nil, fmt.Errorf("task %s is not registered", message.Task)
 	}
+	return task, nil
+}
+
+// runTask runs task with arguments of message
+func (w *CeleryWorker) runTask(task interface{}, message *TaskMessage) (*ResultMessage, error) {
+	// typed tasks decode task message themselves
+	if runner, ok := task.(taskMessageRunner); ok {
+		return runner.runTaskMessage(message)
+	}
 
 	// convert to task interface
 	taskInterface, ok := task.(CeleryTask)
 	if ok {
 		if err := taskInterface.ParseKwargs(message.Kwargs); err != nil {
-			return nil, err
+			return nil, &taskError{excType: "TypeError", err: err}
 		}
 		val, err := taskInterface.RunTask()
 		if err != nil {
-			return nil, err
+			return nil, &taskError{err: err}
 		}
-		return getResultMessage(val), err
+		return getTaskResultMessage(val)
 	}
 
 	// use reflection to execute function ptr
 	taskFunc := reflect.ValueOf(task)
-	return runTaskFunc(&taskFunc, message)
+	return runTaskFunc(&taskFunc, message, w.getTaskOptions(message.Task))
 }
 
-func runTaskFunc(taskFunc *reflect.Value, message *TaskMessage) (*ResultMessage, error) {
+// resultBackend returns backend results are stored in,
+// which is replaced when encryption is enabled
+func (w *CeleryWorker) resultBackend() CeleryBackend {
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	return w.backend
+}
 
-	// check number of arguments
-	numArgs := taskFunc.Type().NumIn()
-	messageNumArgs := len(message.Args)
-	if numArgs != messageNumArgs {
-		return nil, fmt.Errorf("Number of task arguments %d does not match number of message arguments %d", numArgs, messageNumArgs)
+// setEncryption stores results in encrypted backend and accepts encrypted task messages
+// in addition to accepted content set before or after it
+func (w *CeleryWorker) setEncryption(backend *EncryptedBackend) {
+	w.taskLock.Lock()
+	defer w.taskLock.Unlock()
+	w.backend = backend
+}
+
+// acceptsContent reports whether task messages of given content type are accepted.
+// Task messages not received from broker have no content type and are always accepted.
+func (w *CeleryWorker) acceptsContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	if _, encrypted := w.backend.(*EncryptedBackend); encrypted && contentType == EncryptedContentType {
+		return true
 	}
+	return w.acceptContent[contentType]
+}
 
-	// construct arguments
-	in := make([]reflect.Value, messageNumArgs)
-	for i, arg := range message.Args {
-		origType := taskFunc.Type().In(i).Kind()
-		msgType := reflect.TypeOf(arg).Kind()
-		// special case - convert float64 to int if applicable
-		// this is due to json limitation where all numbers are converted to float64
-		if origType == reflect.Int && msgType == reflect.Float64 {
-			arg = int(arg.(float64))
-		}
-		if origType == reflect.Float32 && msgType == reflect.Float64 {
-			arg = float32(arg.(float64))
-		}
+func runTaskFunc(taskFunc *reflect.Value, message *TaskMessage, options *taskOptions) (*ResultMessage, error) {
+	funcType := taskFunc.Type()
+	if funcType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("task %s is %s, not function", message.Task, funcType)
+	}
 
-		in[i] = reflect.ValueOf(arg)
+	// construct arguments converting them to parameter types
+	// this is due to json limitation where all numbers are converted to float64
+	in, err := bindTaskArguments(funcType, message.Args, message.Kwargs, options.argNames)
+	if err != nil {
+		return nil, &taskError{excType: "TypeError", err: fmt.Errorf("task %s: %v", message.Task, err)}
 	}
 
 	// call method
 	res := taskFunc.Call(in)
-	if len(res) == 0 {
-		return nil, nil
+
+	// trailing error is returned as task error
+	if n := len(res); n > 0 && funcType.Out(n-1) == errorType {
+		if err, _ := res[n-1].Interface().(error); err != nil {
+			return nil, &taskError{err: err}
+		}
+		res = res[:n-1]
+	}
+
+	// multiple results are encoded as array like python tuple
+	switch len(res) {
+	case 0:
+		return getResultMessage(nil), nil
+	case 1:
+		return getTaskResultMessage(res[0].Interface())
+	}
+	results := make([]interface{}, len(res))
+	for i := range res {
+		results[i] = res[i].Interface()
+	}
+	return getTaskResultMessage(results)
+}
+
+// getTaskResultMessage encodes task result, refusing results which cannot be encoded like python TypeError
+func getTaskResultMessage(val interface{}) (*ResultMessage, error) {
+	resultMsg, err := getEncodedResultMessage(val)
+	if err != nil {
+		return nil, &taskError{excType: "TypeError", err: err}
 	}
+	return resultMsg, nil
+}
+
+// validateTaskFunc checks that arguments and results of function task can be encoded
+func validateTaskFunc(funcType reflect.Type) error {
+	for i := 0; i < funcType.NumIn(); i++ {
+		if !isEncodableType(funcType.In(i)) {
+			return fmt.Errorf("argument %d has unsupported type %s", i, funcType.In(i))
+		}
+	}
+	for i := 0; i < funcType.NumOut(); i++ {
+		t := funcType.Out(i)
+		if t == errorType && i != funcType.NumOut()-1 {
+			return fmt.Errorf("error must be last result")
+		}
+		if t != errorType && !isEncodableType(t) {
+			return fmt.Errorf("result %d has unsupported type %s", i, t)
+		}
+	}
+	return nil
+}
+
+// isEncodableType reports whether values of type can be sent as task arguments and results
+func isEncodableType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// errorType is type of error interface
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// taskError is error of task itself, which is stored as FAILURE result of task.
+// excType is name of python exception type, Exception by default.
+type taskError struct {
+	excType string
+	err     error
+}
+
+func (e *taskError) Error() string {
+	return e.err.Error()
+}
 
-	return getReflectionResultMessage(&res[0]), nil
+func (e *taskError) Unwrap() error {
+	return e.err
 }
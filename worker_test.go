@@ -6,7 +6,11 @@ package gocelery
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -224,3 +228,284 @@ func TestWorkerStartStop(t *testing.T) {
 		}()
 	}
 }
+
+// divmod is test task method with multiple results and error
+func divmod(a, b int) (int, int, error) {
+	if b == 0 {
+		return 0, 0, errors.New("integer division or modulo by zero")
+	}
+	return a / b, a % b, nil
+}
+
+// TestWorkerTaskResults tests results of functions with multiple results and errors
+func TestWorkerTaskResults(t *testing.T) {
+	backend := NewMemoryBackend()
+	celeryWorker := NewCeleryWorker(NewMemoryBroker(), backend, 1)
+	divmodTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(divmodTask, divmod)
+	noResultTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(noResultTask, func() {})
+	errorTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(errorTask, func(fail bool) error {
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	testCases := []struct {
+		name     string
+		task     string
+		args     []interface{}
+		status   string
+		expected interface{}
+	}{
+		{name: "multiple results", task: divmodTask, args: []interface{}{7, 2},
+			status: "SUCCESS", expected: []interface{}{3.0, 1.0}},
+		{name: "error result", task: divmodTask, args: []interface{}{7, 0}, status: "FAILURE",
+			expected: map[string]interface{}{"exc_type": "Exception", "exc_message": []interface{}{"integer division or modulo by zero"}, "exc_module": "builtins"}},
+		{name: "invalid arguments", task: divmodTask, args: []interface{}{7}, status: "FAILURE"},
+		{name: "no result", task: noResultTask, args: []interface{}{}, status: "SUCCESS"},
+		{name: "nil error", task: errorTask, args: []interface{}{false}, status: "SUCCESS"},
+		{name: "only error", task: errorTask, args: []interface{}{true}, status: "FAILURE",
+			expected: map[string]interface{}{"exc_type": "Exception", "exc_message": []interface{}{"failed"}, "exc_module": "builtins"}},
+	}
+	for _, tc := range testCases {
+		taskMessage := &TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: tc.task, Args: tc.args}
+		celeryWorker.processTaskMessage(taskMessage)
+		resultMsg, err := backend.GetResult(taskMessage.ID)
+		if err != nil {
+			t.Errorf("test '%s': failed to get result: %v", tc.name, err)
+			continue
+		}
+		if resultMsg.Status != tc.status {
+			t.Errorf("test '%s': expected status %s but received %s", tc.name, tc.status, resultMsg.Status)
+		}
+		if tc.name == "invalid arguments" {
+			if excType := resultMsg.Result.(map[string]interface{})["exc_type"]; excType != "TypeError" {
+				t.Errorf("test '%s': expected TypeError but received %v", tc.name, excType)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(resultMsg.Result, tc.expected) {
+			t.Errorf("test '%s': expected result %#v but received %#v", tc.name, tc.expected, resultMsg.Result)
+		}
+	}
+
+	var data []byte
+	if err := decodeResultValue("aGk=", &data); err != nil || string(data) != "hi" {
+		t.Errorf("expected bytes result to be decoded into 'hi' but received %q: %v", data, err)
+	}
+	pythonBytes := map[string]interface{}{"__type__": "bytes", "__value__": "hi"}
+	if err := decodeResultValue(pythonBytes, &data); err != nil || string(data) != "hi" {
+		t.Errorf("expected kombu bytes result to be decoded into 'hi' but received %q: %v", data, err)
+	}
+
+	invalidTasks := []struct {
+		name string
+		task interface{}
+	}{
+		{name: "nil task", task: nil},
+		{name: "non-function task", task: 42},
+		{name: "channel argument", task: func(chan int) {}},
+		{name: "function result", task: func() func() { return nil }},
+		{name: "error before result", task: func() (error, int) { return nil, 0 }},
+	}
+	for _, tc := range invalidTasks {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("test '%s': expected registering task to panic", tc.name)
+				}
+			}()
+			celeryWorker.Register(uuid.Must(uuid.NewV4()).String(), tc.task)
+		}()
+	}
+}
+
+// encodedPoint is test result encoded by its json tags
+type encodedPoint struct {
+	X      int           `json:"x"`
+	Y      int           `json:"y,omitempty"`
+	Label  *string       `json:"label"`
+	Hidden string        `json:"-"`
+	At     time.Time     `json:"at"`
+	ID     uuid.UUID     `json:"id"`
+	Parent *encodedPoint `json:"parent,omitempty"`
+}
+
+// celsius is test result implementing json.Marshaler
+type celsius float64
+
+func (c celsius) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%.1fC"`, float64(c))), nil
+}
+
+// TestWorkerTaskResultEncoding tests encoding of task results of any type
+func TestWorkerTaskResultEncoding(t *testing.T) {
+	celeryWorker := NewCeleryWorker(NewMemoryBroker(), NewMemoryBackend(), 1)
+	label := "origin"
+	at := time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)
+	id := uuid.Must(uuid.FromString("0f8fad5b-d9cb-469f-a165-70867728950e"))
+	testCases := []struct {
+		name     string
+		task     interface{}
+		expected interface{}
+	}{
+		{
+			name: "struct",
+			task: func() encodedPoint {
+				return encodedPoint{X: 1, Label: &label, Hidden: "secret", At: at, ID: id, Parent: &encodedPoint{X: 2, At: at, ID: id}}
+			},
+			expected: map[string]interface{}{
+				"x": int64(1), "label": "origin", "at": "2021-03-04T05:06:07.123456Z", "id": id.String(),
+				"parent": map[string]interface{}{
+					"x": int64(2), "label": nil, "at": "2021-03-04T05:06:07.123456Z", "id": id.String(),
+				},
+			},
+		},
+		{name: "nil pointer", task: func() *encodedPoint { return nil }, expected: nil},
+		{name: "time", task: func() time.Time { return at }, expected: "2021-03-04T05:06:07.123456Z"},
+		{name: "json marshaler", task: func() celsius { return 21.5 }, expected: "21.5C"},
+		{name: "interface", task: func() interface{} { return []int{1, 2} }, expected: []interface{}{int64(1), int64(2)}},
+		{name: "array", task: func() [2]bool { return [2]bool{true, false} }, expected: []interface{}{true, false}},
+		{name: "uint", task: func() uint64 { return 42 }, expected: int64(42)},
+		{name: "bytes", task: func() []byte { return []byte("hi") }, expected: "aGk="},
+	}
+	for _, tc := range testCases {
+		taskName := uuid.Must(uuid.NewV4()).String()
+		celeryWorker.Register(taskName, tc.task)
+		resultMsg, err := celeryWorker.RunTask(&TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{}})
+		if err != nil {
+			t.Errorf("test '%s': failed to run task: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(resultMsg.Result, tc.expected) {
+			t.Errorf("test '%s': expected result %#v but received %#v", tc.name, tc.expected, resultMsg.Result)
+		}
+	}
+
+	taskName := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(taskName, func() float64 { return math.NaN() })
+	_, err := celeryWorker.RunTask(&TaskMessage{ID: uuid.Must(uuid.NewV4()).String(), Task: taskName, Args: []interface{}{}})
+	var taskErr *taskError
+	if !errors.As(err, &taskErr) || taskErr.excType != "TypeError" {
+		t.Errorf("expected result which cannot be encoded to fail task with TypeError but received %v", err)
+	}
+}
+
+// TestWorkerTrackStarted tests reporting states of running tasks
+func TestWorkerTrackStarted(t *testing.T) {
+	backend := NewMemoryBackend()
+	broker := NewMemoryBroker()
+	celeryWorker := NewCeleryWorker(broker, backend, 1)
+	celeryWorker.SetTrackStarted(true)
+	release := make(chan struct{})
+	blockingTask := func() int {
+		<-release
+		return 1
+	}
+	startedTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(startedTask, blockingTask)
+	untrackedTask := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(untrackedTask, blockingTask, WithTrackStarted(false))
+	testCases := []struct {
+		name  string
+		task  string
+		state string
+	}{
+		{name: "started task", task: startedTask, state: StateStarted},
+		{name: "untracked task", task: untrackedTask, state: StatePending},
+	}
+	for _, tc := range testCases {
+		taskMessage := getTaskMessage(tc.task)
+		asyncResult := NewAsyncResult(taskMessage.ID, backend)
+		done := make(chan struct{})
+		go func() {
+			celeryWorker.processTaskMessage(taskMessage)
+			close(done)
+		}()
+
+		// state is reported before task finishes
+		time.Sleep(50 * time.Millisecond)
+		state, err := asyncResult.State()
+		if err != nil || state != tc.state {
+			t.Errorf("test '%s': expected state %s of running task but received %s: %v", tc.name, tc.state, state, err)
+		}
+		if state == StateStarted {
+			info, _ := asyncResult.Info()
+			meta, _ := info.(map[string]interface{})
+			if meta["hostname"] != celeryWorker.hostname || meta["pid"] != float64(os.Getpid()) {
+				t.Errorf("test '%s': received unexpected metadata of started task %v", tc.name, info)
+			}
+		}
+		release <- struct{}{}
+		<-done
+		releaseTaskMessage(taskMessage)
+		if state, err := asyncResult.State(); err != nil || state != StateSuccess {
+			t.Errorf("test '%s': expected finished task to succeed but received state %s: %v", tc.name, state, err)
+		}
+	}
+}
+
+// TestWorkerTrackReceived tests reporting RECEIVED state of tasks waiting for busy worker
+func TestWorkerTrackReceived(t *testing.T) {
+	backend := NewMemoryBackend()
+	broker := NewMemoryBroker()
+	celeryWorker := NewCeleryWorker(broker, backend, 1)
+	celeryWorker.rateLimitPeriod = 10 * time.Millisecond
+	celeryWorker.SetTrackStarted(true)
+	celeryWorker.SetTrackReceived(true)
+	release := make(chan struct{})
+	taskName := uuid.Must(uuid.NewV4()).String()
+	celeryWorker.Register(taskName, func() int {
+		<-release
+		return 1
+	})
+	var results []*AsyncResult
+	for i := 0; i < 3; i++ {
+		taskMessage := getTaskMessage(taskName)
+		results = append(results, NewAsyncResult(taskMessage.ID, backend))
+		encodedTaskMessage, err := taskMessage.Encode()
+		if err != nil {
+			t.Fatalf("failed to encode task message: %v", err)
+		}
+		celeryMessage := getCeleryMessage(encodedTaskMessage)
+		if err := broker.SendCeleryMessage(celeryMessage); err != nil {
+			t.Fatalf("failed to send task message: %v", err)
+		}
+	}
+	celeryWorker.StartWorker()
+
+	// next task is received while first one is running, the last one stays in queue
+	expected := []string{StateStarted, StateReceived, StatePending}
+	for i, ar := range results {
+		if state := waitForState(ar, expected[i]); state != expected[i] {
+			t.Errorf("expected state %s of task %d but received %s", expected[i], i, state)
+		}
+	}
+	release <- struct{}{}
+	if state := waitForState(results[1], StateStarted); state != StateStarted {
+		t.Errorf("expected received task to be started after first one but received %s", state)
+	}
+	if state := waitForState(results[2], StateReceived); state != StateReceived {
+		t.Errorf("expected last task to be received but received %s", state)
+	}
+	close(release)
+	celeryWorker.StopWorker()
+	for i, ar := range results {
+		if state, err := ar.State(); err != nil || state != StateSuccess {
+			t.Errorf("expected task %d to succeed after worker is stopped but received %s: %v", i, state, err)
+		}
+	}
+}
+
+// waitForState polls state of task until it is expected one or timeout is reached
+func waitForState(ar *AsyncResult, expected string) string {
+	var state string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if state, _ = ar.State(); state == expected {
+			break
+		}
+	}
+	return state
+}